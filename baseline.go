@@ -0,0 +1,129 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// historyBaseline is the direction recorded in the history table for baselined migrations.
+const historyBaseline = "baseline"
+
+var (
+	ErrAlreadyMigrated = errors.New("migrator: database has already been migrated")
+	ErrUnknownBaseline = errors.New("migrator: baseline version does not match any migration")
+)
+
+// setup initializes the database for migrations. If a baseline version was given and the
+// database has never been migrated, it is at version 0 and has no history, it is baselined at
+// that version. The baseline version is validated before the database is changed. New databases
+// and tables created by earlier releases are initialized while holding the migration lock,
+// processes starting at the same time would otherwise race to create or upgrade the metadata
+// tables.
+func (b base) setup(ctx context.Context) error {
+	if b.baselineVersion != nil {
+		if _, found := b.migrations.position(*b.baselineVersion); !found {
+			return fmt.Errorf("%w: %v", ErrUnknownBaseline, *b.baselineVersion)
+		}
+	}
+	_, upToDate, err := b.dialect.Initialized(ctx, b.db, b.md)
+	if err != nil {
+		return err
+	}
+	if upToDate && b.baselineVersion == nil {
+		// nothing to do, a stale lock must not prevent Unlock
+		return nil
+	}
+	return b.withLock(ctx, func() error {
+		if err := b.init(ctx); err != nil {
+			return err
+		}
+		if b.baselineVersion == nil {
+			return nil
+		}
+		migrated, err := b.migrated(ctx)
+		if err != nil || migrated {
+			return err
+		}
+		return b.applyBaseline(ctx, *b.baselineVersion)
+	})
+}
+
+// migrated returns true if the database is not at version 0 or has history, migrations have
+// been run or it has been baselined before.
+func (b base) migrated(ctx context.Context) (bool, error) {
+	v, err := b.version(ctx)
+	if err != nil {
+		return false, err
+	}
+	if v != targetStart {
+		return true, nil
+	}
+	history, err := b.HistoryContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(history) > 0, nil
+}
+
+// baseline sets the version of a database that has not been migrated, without running any
+// migrations. Like setup it treats a database not at version 0 or with history as migrated.
+func (b base) baseline(ctx context.Context, version int) error {
+	if _, found := b.migrations.position(version); !found {
+		return fmt.Errorf("%w: %v", ErrUnknownBaseline, version)
+	}
+	return b.withLock(ctx, func() error {
+		migrated, err := b.migrated(ctx)
+		if err != nil {
+			return err
+		}
+		if migrated {
+			return ErrAlreadyMigrated
+		}
+		return b.applyBaseline(ctx, version)
+	})
+}
+
+// applyBaseline sets the version, the caller must hold the migration lock. Checksums are stored
+// for all migrations up to and including version and they are recorded as baselined in the
+// history table.
+func (b base) applyBaseline(ctx context.Context, version int) error {
+	if err := b.checkDirty(ctx); err != nil {
+		return err
+	}
+	pos, _ := b.migrations.position(version)
+	baselined := b.migrations.Migrations[:pos]
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := b.setVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	for _, bm := range baselined {
+		if err := b.setChecksum(ctx, tx, bm.version, bm.Checksum()); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, bm := range baselined {
+		entry := HistoryEntry{
+			Version:    bm.version,
+			Direction:  historyBaseline,
+			Comment:    bm.Comment,
+			Checksum:   bm.Checksum(),
+			StartedAt:  now,
+			FinishedAt: now,
+			Success:    true,
+		}
+		if err := b.addHistory(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
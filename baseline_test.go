@@ -0,0 +1,167 @@
+package migrator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSQLiteBaseline(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	// existing schema matching the first two migrations
+	if _, err := db.Exec("CREATE TABLE a (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE b (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Comment: "c", Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithLatest())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if err := m.Baseline(5); !errors.Is(err, ErrUnknownBaseline) {
+		t.Errorf("expected %v but got %v", ErrUnknownBaseline, err)
+	}
+	if err := m.Baseline(2); err != nil {
+		t.Fatalf("error while running Baseline: %s", err)
+	}
+	if v, err := m.Version(); err != nil || v != 2 {
+		t.Errorf("expected version 2 after Baseline but got %v, %v", v, err)
+	}
+	ran, err := m.Migrate()
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 1 || ran[0].Version() != 3 {
+		t.Errorf("expected only version 3 to run but got %v", ran)
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatalf("error while running History: %s", err)
+	}
+	expected := []string{historyBaseline, historyBaseline, "up"}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %v history entries but got %v", len(expected), len(history))
+	}
+	for i, e := range history {
+		if e.Version != i+1 || e.Direction != expected[i] {
+			t.Errorf("%v: expected version %v %s but got %v %s", i, i+1, expected[i], e.Version, e.Direction)
+		}
+	}
+
+	if err := m.Baseline(1); !errors.Is(err, ErrAlreadyMigrated) {
+		t.Errorf("expected %v but got %v", ErrAlreadyMigrated, err)
+	}
+}
+
+func TestSQLiteBaselineMigratedDown(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithLatest())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(0), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	// back at version 0 but with history, the tables of the migrations does not exist
+	if err := m.Baseline(2); !errors.Is(err, ErrAlreadyMigrated) {
+		t.Errorf("expected %v but got %v", ErrAlreadyMigrated, err)
+	}
+	if v, err := m.Version(); err != nil || v != 0 {
+		t.Errorf("expected version 0 after a rejected Baseline but got %v, %v", v, err)
+	}
+}
+
+func TestSQLiteWithBaseline(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	// an unknown baseline version must not initialize the database
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithBaseline(7)); !errors.Is(err, ErrUnknownBaseline) {
+		t.Fatalf("expected %v but got %v", ErrUnknownBaseline, err)
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM sqlite_master WHERE name LIKE '%migrator%'").Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected no metadata tables but got %v: %v", count, err)
+	}
+
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithBaseline(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if v, _ := m.Version(); v != 1 {
+		t.Errorf("expected version 1 after baseline but got %v", v)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	// baseline is ignored when the database has already been initialized
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(2), WithBaseline(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if v, _ := m.Version(); v != 1 {
+		t.Errorf("expected version to still be 1 but got %v", v)
+	}
+}
+
+func TestSQLiteWithBaselineInitialized(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	// initialized but never migrated
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1)); err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE a (id INTEGER); CREATE TABLE b (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2), WithBaseline(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Errorf("expected version 2 after baseline but got %v", v)
+	}
+
+	// a database migrated down to version 0 has history and is not baselined
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(0), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(2), WithBaseline(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version to still be 0 but got %v", v)
+	}
+}
@@ -0,0 +1,104 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChecksumError is returned when migrations applied to the database has been changed, or
+// removed, since they were run. Call Repair on the Migrator if the changes were deliberate.
+type ChecksumError struct {
+	// Versions holds the versions with a checksum that does not match the migrations.
+	Versions []int
+}
+
+func (e *ChecksumError) Error() string {
+	versions := make([]string, len(e.Versions))
+	for i, v := range e.Versions {
+		versions[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("migrator: applied migrations have changed since they were run, checksum mismatch for version %s", strings.Join(versions, ", "))
+}
+
+// Checksum returns a SHA-256 checksum, in hex, of the up and down statements of the migration.
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	h.Write([]byte(m.Up))
+	h.Write([]byte{0})
+	h.Write([]byte(m.Down))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifiedVersion returns the current version from the database after verifying the checksums
+// of the applied migrations.
+func (b base) verifiedVersion(ctx context.Context) (int, error) {
+	v, err := b.version(ctx)
+	if err != nil {
+		return -1, err
+	}
+	if err := b.verifyChecksums(ctx); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// verifyChecksums compares checksums stored in the database with the loaded migrations. Migrations
+// applied before checksums were introduced have no stored checksum and are not verified.
+func (b base) verifyChecksums(ctx context.Context) error {
+	stored, err := b.checksums(ctx)
+	if err != nil {
+		return err
+	}
+	mismatch := []int{}
+	for version, checksum := range stored {
+		pos, found := b.migrations.position(version)
+		if !found || version == targetStart || b.migrations.Migrations[pos-1].Checksum() != checksum {
+			mismatch = append(mismatch, version)
+		}
+	}
+	if len(mismatch) > 0 {
+		slices.Sort(mismatch)
+		return &ChecksumError{Versions: mismatch}
+	}
+	return nil
+}
+
+// repair rewrites the stored checksums to match the loaded migrations that are applied to the
+// database.
+func (b base) repair(ctx context.Context) error {
+	return b.withLock(ctx, func() error {
+		return b.repairChecksums(ctx)
+	})
+}
+
+func (b base) repairChecksums(ctx context.Context) error {
+	v, err := b.version(ctx)
+	if err != nil {
+		return err
+	}
+	pos, found := b.migrations.position(v)
+	if !found {
+		return fmt.Errorf("%w: %v", ErrUnknownVersion, v)
+	}
+	stored, err := b.checksums(ctx)
+	if err != nil {
+		return err
+	}
+	for version := range stored {
+		if p, found := b.migrations.position(version); !found || p > pos {
+			if err := b.deleteChecksum(ctx, b.db, version); err != nil {
+				return err
+			}
+		}
+	}
+	for _, applied := range b.migrations.Migrations[:pos] {
+		if err := b.setChecksum(ctx, b.db, applied.version, applied.Checksum()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
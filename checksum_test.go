@@ -0,0 +1,86 @@
+package migrator
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	a := Migration{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}
+	if a.Checksum() != a.Checksum() {
+		t.Errorf("expected checksum to be stable")
+	}
+	b := Migration{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE b"}
+	if a.Checksum() == b.Checksum() {
+		t.Errorf("expected checksums of different migrations to differ")
+	}
+	// moving text between up and down must change the checksum
+	c := Migration{Up: "SELECT 1SELECT", Down: " 2"}
+	d := Migration{Up: "SELECT 1", Down: "SELECT 2"}
+	if c.Checksum() == d.Checksum() {
+		t.Errorf("expected checksums of different migrations to differ")
+	}
+}
+
+func TestSQLiteChecksums(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	// edit an applied migration
+	edited := Migrations{Migrations: slices.Clone(migrations.Migrations)}
+	edited.Migrations[1].Up = "CREATE TABLE b (id INTEGER, name TEXT)"
+	m, err = New(db, Sqlite, WithMigrations(edited), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	var checksumErr *ChecksumError
+	if _, err := m.Version(); !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a *ChecksumError but got %v", err)
+	}
+	if !slices.Equal(checksumErr.Versions, []int{2}) {
+		t.Errorf("expected mismatch for versions %v but got %v", []int{2}, checksumErr.Versions)
+	}
+	if _, err := m.Migrate(); !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a *ChecksumError but got %v", err)
+	}
+
+	// repair and migrate
+	if err := m.Repair(); err != nil {
+		t.Fatalf("error while running Repair: %s", err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatalf("unexpected error after Repair: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	// downgrading removes checksums, editing a migration that is no longer applied is allowed
+	m, err = New(db, Sqlite, WithMigrations(edited), WithTarget(1), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,517 @@
+// Command migrator runs database migrations from the command line.
+//
+//	migrator -driver postgres -dsn postgres://localhost/app -file migrations.yml up
+//
+// Run migrator -h for all flags and commands.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/spagettikod/migrator"
+)
+
+// Exit codes, scripts can use them to tell why migrator failed.
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitDirty     = 3
+	exitChecksum  = 4
+	exitLock      = 5
+	exitDowngrade = 6
+	exitNotInit   = 7
+)
+
+const usage = `usage: migrator [flags] <command> [arguments]
+
+commands:
+  up [N]      migrate to the last migration, or N migrations up
+  down N      migrate N migrations down
+  goto V      migrate to version or tag V, use -allow-down to allow it to downgrade
+  status      print the status of all migrations
+  version     print the current version of the database
+  force V     set the version to V without running any migrations and clear the dirty flag
+  unlock      release a migration lock left behind by a process that crashed
+  validate    validate the migrations without connecting to the database
+  create [-id N | -timestamp] COMMENT
+              append a new migration to the migrations file and print its version
+  plan CMD    print what up, down or goto would run without running it, e.g. plan down 1
+
+exit codes:
+  0  success
+  1  migration or database error
+  2  invalid flags, command or arguments
+  3  the database is dirty, fix it manually and run force
+  4  applied migrations has been changed since they were run
+  5  timed out waiting for the migration lock, run unlock if no other process is migrating
+  6  goto, or plan goto, would downgrade the database but -allow-down was not given
+  7  status or version on a database without the migrator tables, check -dsn
+
+flags:
+`
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+type cli struct {
+	driver      string
+	dsn         string
+	file        string
+	dir         string
+	schema      string
+	lockTimeout time.Duration
+	json        bool
+	allowDown   bool
+	stdout      io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	c := cli{stdout: stdout}
+	fs := flag.NewFlagSet("migrator", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&c.driver, "driver", "sqlite", "database driver, sqlite or postgres")
+	fs.StringVar(&c.dsn, "dsn", "", "data source name of the database")
+	fs.StringVar(&c.file, "file", os.Getenv("MIGRATOR_FILE"), "migrations YAML-file, defaults to $MIGRATOR_FILE")
+	fs.StringVar(&c.dir, "dir", "", "directory with .up.sql and .down.sql files, used instead of -file")
+	fs.StringVar(&c.schema, "schema", "", "schema for the metadata tables, PostgreSQL schema (default public) or SQLite attached database")
+	fs.DurationVar(&c.lockTimeout, "lock-timeout", time.Minute, "how long to wait for the migration lock")
+	fs.BoolVar(&c.json, "json", false, "print output as JSON")
+	allowDown, _ := strconv.ParseBool(os.Getenv("MIGRATOR_ALLOW_DOWN"))
+	fs.BoolVar(&c.allowDown, "allow-down", allowDown, "allow goto to downgrade the database, defaults to $MIGRATOR_ALLOW_DOWN")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	err := c.run(fs.Arg(0), fs.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+	var printed printedError
+	if c.json {
+		if !errors.As(err, &printed) {
+			c.print(map[string]string{"error": err.Error()}, "")
+		}
+	} else {
+		fmt.Fprintln(stderr, err)
+	}
+	return exitCode(err)
+}
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var usageErr usageError
+	var checksumErr *migrator.ChecksumError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, migrator.ErrDirty):
+		return exitDirty
+	case errors.As(err, &checksumErr):
+		return exitChecksum
+	case errors.Is(err, migrator.ErrLockTimeout):
+		return exitLock
+	case errors.Is(err, migrator.ErrDowngrade):
+		return exitDowngrade
+	case errors.Is(err, migrator.ErrMigratorNotInitialized):
+		return exitNotInit
+	}
+	return exitError
+}
+
+func (c cli) run(cmd string, args []string) error {
+	switch cmd {
+	case "up", "down", "goto":
+		target, err := c.targetOptions(cmd, args)
+		if err != nil {
+			return err
+		}
+		return c.migrate(target...)
+	case "plan":
+		if len(args) == 0 {
+			return usageError("plan requires a command, up, down or goto")
+		}
+		target, err := c.targetOptions(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		return c.plan(target...)
+	case "status":
+		if err := noArgs(cmd, args); err != nil {
+			return err
+		}
+		return c.status()
+	case "version":
+		if err := noArgs(cmd, args); err != nil {
+			return err
+		}
+		return c.version()
+	case "force":
+		if len(args) != 1 {
+			return usageError("force requires a version")
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid version %q", args[0]))
+		}
+		return c.force(version)
+	case "unlock":
+		if err := noArgs(cmd, args); err != nil {
+			return err
+		}
+		return c.unlock()
+	case "validate":
+		if err := noArgs(cmd, args); err != nil {
+			return err
+		}
+		return c.validate()
+	case "create":
+		return c.create(args)
+	}
+	return usageError(fmt.Sprintf("unknown command %q", cmd))
+}
+
+func noArgs(cmd string, args []string) error {
+	if len(args) != 0 {
+		return usageError(fmt.Sprintf("%s takes no arguments", cmd))
+	}
+	return nil
+}
+
+// targetOptions returns the target options for the migration command cmd. down allows
+// exactly the requested number of migrations to be reverted, goto only downgrades if
+// -allow-down was given.
+func (c cli) targetOptions(cmd string, args []string) ([]migrator.Option, error) {
+	switch cmd {
+	case "up":
+		if len(args) == 0 {
+			return []migrator.Option{migrator.WithLatest()}, nil
+		}
+		n, err := steps(cmd, args)
+		return []migrator.Option{migrator.WithSteps(n)}, err
+	case "down":
+		if len(args) == 0 {
+			return nil, usageError("down requires the number of migrations to migrate down")
+		}
+		n, err := steps(cmd, args)
+		return []migrator.Option{migrator.WithSteps(-n), migrator.WithMaxDownSteps(n)}, err
+	case "goto":
+		if len(args) != 1 {
+			return nil, usageError("goto requires a version or tag")
+		}
+		opts := []migrator.Option{migrator.WithTag(args[0])}
+		if version, err := strconv.Atoi(args[0]); err == nil {
+			opts = []migrator.Option{migrator.WithTarget(version)}
+		}
+		if c.allowDown {
+			opts = append(opts, migrator.WithAllowDown())
+		}
+		return opts, nil
+	}
+	return nil, usageError(fmt.Sprintf("unknown migration command %q, expected up, down or goto", cmd))
+}
+
+func steps(cmd string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, usageError(fmt.Sprintf("%s takes at most one argument", cmd))
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, usageError(fmt.Sprintf("invalid number of migrations %q", args[0]))
+	}
+	return n, nil
+}
+
+// load reads the migrations from the directory or file given by the flags.
+func (c cli) load() (migrator.Migrations, error) {
+	switch {
+	case c.dir != "":
+		return migrator.LoadMigrationsDir(os.DirFS(c.dir), ".")
+	case c.file != "":
+		return migrator.LoadMigrations(c.file)
+	}
+	return migrator.Migrations{}, usageError("either -file or -dir is required")
+}
+
+// open connects to the database and returns a migrator for it. The returned database must be
+// closed by the caller.
+func (c cli) open(opts ...migrator.Option) (migrator.Migrator, *sql.DB, error) {
+	var driver string
+	var dialect migrator.Dialect
+	switch c.driver {
+	case "sqlite", "sqlite3":
+		driver, dialect = "sqlite3", migrator.Sqlite
+	case "postgres", "postgresql", "pgx":
+		driver, dialect = "pgx", migrator.Postgres
+	default:
+		return nil, nil, usageError(fmt.Sprintf("unknown driver %q, expected sqlite or postgres", c.driver))
+	}
+	if c.dsn == "" {
+		return nil, nil, usageError("-dsn is required")
+	}
+	migrations, err := c.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open(driver, c.dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, migrator.WithMigrations(migrations), migrator.WithLockTimeout(c.lockTimeout))
+	if c.schema != "" {
+		opts = append(opts, migrator.WithSchema(c.schema))
+	}
+	m, err := migrator.New(db, dialect, opts...)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return m, db, nil
+}
+
+// print writes v as JSON if the json flag is set, otherwise text.
+func (c cli) print(v any, text string) {
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	fmt.Fprint(c.stdout, text)
+}
+
+// printedError is an error already printed as part of the JSON output of a command.
+type printedError struct {
+	error
+}
+
+func (e printedError) Unwrap() error {
+	return e.error
+}
+
+type migrationOutput struct {
+	Version int    `json:"version"`
+	Comment string `json:"comment,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+func newMigrationOutput(m migrator.Migration) migrationOutput {
+	return migrationOutput{Version: m.Version(), Comment: m.Comment, Tag: m.Tag}
+}
+
+func (c cli) migrate(target ...migrator.Option) error {
+	m, db, err := c.open(target...)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	applied, err := m.Migrate()
+	out := struct {
+		Applied []migrationOutput `json:"applied"`
+		Version int               `json:"version"`
+		Error   string            `json:"error,omitempty"`
+	}{Applied: []migrationOutput{}}
+	text := ""
+	for _, a := range applied {
+		out.Applied = append(out.Applied, newMigrationOutput(a))
+		text += fmt.Sprintf("migrated version %v: %s\n", a.Version(), a.Comment)
+	}
+	if err != nil {
+		// print what was applied before the failure, as JSON together with the error, as text the
+		// error is printed by run
+		if !c.json {
+			c.print(out, text)
+			return err
+		}
+		out.Error = err.Error()
+		if v, verr := m.Version(); verr == nil {
+			out.Version = v
+		}
+		c.print(out, "")
+		return printedError{err}
+	}
+	if out.Version, err = m.Version(); err != nil {
+		return err
+	}
+	c.print(out, text+fmt.Sprintf("database is at version %v\n", out.Version))
+	return nil
+}
+
+func (c cli) plan(target ...migrator.Option) error {
+	// a dry run does not initialize the database
+	m, db, err := c.open(append(target, migrator.WithDryRun())...)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	p, err := m.Plan()
+	if err != nil {
+		return err
+	}
+	type stepOutput struct {
+		migrationOutput
+		Statements []string `json:"statements"`
+	}
+	out := struct {
+		Version   int          `json:"version"`
+		Target    int          `json:"target"`
+		Direction string       `json:"direction"`
+		Steps     []stepOutput `json:"steps"`
+	}{Version: p.Version, Target: p.Target, Direction: p.Direction, Steps: []stepOutput{}}
+	for _, s := range p.Steps {
+		out.Steps = append(out.Steps, stepOutput{migrationOutput: newMigrationOutput(s.Migration), Statements: s.Statements})
+	}
+	c.print(out, p.String())
+	return nil
+}
+
+func (c cli) status() error {
+	// a dry run does not initialize the database, a mistyped -dsn fails instead of reporting
+	// an empty database
+	m, db, err := c.open(migrator.WithLatest(), migrator.WithDryRun())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	s, err := m.Status()
+	if err != nil {
+		return err
+	}
+	type migrationStatusOutput struct {
+		migrationOutput
+		Applied   bool       `json:"applied"`
+		AppliedAt *time.Time `json:"applied_at,omitempty"`
+		Checksum  string     `json:"checksum,omitempty"`
+		HasDown   bool       `json:"has_down"`
+	}
+	out := struct {
+		Version    int                     `json:"version"`
+		Dirty      int                     `json:"dirty"`
+		Unknown    bool                    `json:"unknown"`
+		Migrations []migrationStatusOutput `json:"migrations"`
+	}{Version: s.Version, Dirty: s.Dirty, Unknown: s.Unknown, Migrations: []migrationStatusOutput{}}
+	for _, ms := range s.Migrations {
+		mo := migrationStatusOutput{
+			migrationOutput: newMigrationOutput(ms.Migration),
+			Applied:         ms.Applied,
+			Checksum:        string(ms.Checksum),
+			HasDown:         ms.HasDown,
+		}
+		if !ms.AppliedAt.IsZero() {
+			mo.AppliedAt = &ms.AppliedAt
+		}
+		out.Migrations = append(out.Migrations, mo)
+	}
+	c.print(out, s.String())
+	return nil
+}
+
+func (c cli) version() error {
+	m, db, err := c.open(migrator.WithLatest(), migrator.WithDryRun())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	v, err := m.Version()
+	if err != nil {
+		return err
+	}
+	c.print(map[string]int{"version": v}, fmt.Sprintf("%v\n", v))
+	return nil
+}
+
+func (c cli) force(version int) error {
+	m, db, err := c.open(migrator.WithLatest())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := m.Force(version); err != nil {
+		return err
+	}
+	c.print(map[string]int{"version": version}, fmt.Sprintf("database forced to version %v\n", version))
+	return nil
+}
+
+func (c cli) unlock() error {
+	m, db, err := c.open(migrator.WithLatest())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := m.Unlock(); err != nil {
+		return err
+	}
+	c.print(map[string]bool{"unlocked": true}, "migration lock released\n")
+	return nil
+}
+
+func (c cli) validate() error {
+	ms, err := c.load()
+	if err != nil {
+		return err
+	}
+	out := struct {
+		Valid      bool `json:"valid"`
+		Migrations int  `json:"migrations"`
+	}{Valid: true, Migrations: len(ms.Migrations)}
+	c.print(out, fmt.Sprintf("%v migrations are valid\n", out.Migrations))
+	return nil
+}
+
+func (c cli) create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	id := fs.Int("id", 0, "")
+	timestamp := fs.Bool("timestamp", false, "")
+	if err := fs.Parse(args); err != nil {
+		return usageError(fmt.Sprintf("create: %s", err))
+	}
+	if fs.NArg() == 0 {
+		return usageError("create requires a comment")
+	}
+	if *timestamp {
+		if *id != 0 {
+			return usageError("create: -id and -timestamp can not be used together")
+		}
+		*id, _ = strconv.Atoi(time.Now().UTC().Format("20060102150405"))
+	}
+	if c.file == "" {
+		return usageError("create requires -file")
+	}
+	version, err := migrator.CreateMigration(c.file, strings.Join(fs.Args(), " "), *id)
+	if err != nil {
+		return err
+	}
+	c.print(map[string]int{"version": version}, fmt.Sprintf("created migration with version %v in %s\n", version, c.file))
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	flags := []string{"-driver", "sqlite", "-dsn", dsn, "-file", "../../testdata/migrations.yml"}
+
+	cases := []struct {
+		Args     []string
+		Code     int
+		Contains string
+	}{
+		{Args: []string{"validate"}, Code: exitOK, Contains: "2 migrations are valid"},
+		{Args: []string{"version"}, Code: exitNotInit},
+		{Args: []string{"status"}, Code: exitNotInit},
+		{Args: []string{"plan", "up"}, Code: exitOK, Contains: "-- migrating up from version 0 to 2"},
+		{Args: []string{"up", "1"}, Code: exitOK, Contains: "database is at version 1"},
+		{Args: []string{"up"}, Code: exitOK, Contains: "database is at version 2"},
+		{Args: []string{"version"}, Code: exitOK, Contains: "2"},
+		{Args: []string{"down", "2"}, Code: exitOK, Contains: "database is at version 0"},
+		{Args: []string{"goto", "2"}, Code: exitOK, Contains: "database is at version 2"},
+		{Args: []string{"status"}, Code: exitOK, Contains: "version 2"},
+		{Args: []string{"plan", "goto", "0"}, Code: exitDowngrade},
+		{Args: []string{"-allow-down", "plan", "goto", "0"}, Code: exitOK, Contains: "-- migrating down from version 2 to 0"},
+		{Args: []string{"goto", "0"}, Code: exitDowngrade},
+		{Args: []string{"-allow-down", "goto", "0"}, Code: exitOK, Contains: "database is at version 0"},
+		{Args: []string{"force", "1"}, Code: exitOK, Contains: "database forced to version 1"},
+		{Args: []string{"unlock"}, Code: exitOK, Contains: "migration lock released"},
+		{Args: []string{"goto", "5"}, Code: exitError},
+		{Args: []string{"down"}, Code: exitUsage},
+		{Args: []string{"unknown"}, Code: exitUsage},
+	}
+	for _, tc := range cases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		if code := run(append(flags, tc.Args...), stdout, stderr); code != tc.Code {
+			t.Fatalf("%v: expected exit code %v but got %v: %s", tc.Args, tc.Code, code, stderr)
+		}
+		if !strings.Contains(stdout.String(), tc.Contains) {
+			t.Errorf("%v: expected output to contain %q but got:\n%s", tc.Args, tc.Contains, stdout)
+		}
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	args := []string{"-json", "-dsn", dsn, "-file", "../../testdata/migrations.yml", "up"}
+	if code := run(args, stdout, stderr); code != exitOK {
+		t.Fatalf("expected exit code %v but got %v: %s", exitOK, code, stderr)
+	}
+	out := struct {
+		Applied []migrationOutput
+		Version int
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("could not parse output: %s\n%s", err, stdout)
+	}
+	if out.Version != 2 || len(out.Applied) != 2 {
+		t.Errorf("expected 2 applied migrations and version 2 but got %+v", out)
+	}
+
+	stdout.Reset()
+	args = []string{"-json", "-dsn", dsn, "-file", "../../testdata/migrations.yml", "goto", "5"}
+	if code := run(args, stdout, stderr); code != exitError {
+		t.Fatalf("expected exit code %v but got %v", exitError, code)
+	}
+	failure := map[string]string{}
+	if err := json.Unmarshal(stdout.Bytes(), &failure); err != nil {
+		t.Fatalf("could not parse output: %s\n%s", err, stdout)
+	}
+	if failure["error"] == "" {
+		t.Errorf("expected an error in output but got %s", stdout)
+	}
+
+	// a failing migration reports the migrations applied before it together with the error
+	file := filepath.Join(t.TempDir(), "migrations.yml")
+	migrations := "migrations:\n  - up: CREATE TABLE a (id INTEGER)\n    down: DROP TABLE a\n  - up: NOT SQL\n    down: SELECT 1\n"
+	if err := os.WriteFile(file, []byte(migrations), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	args = []string{"-json", "-dsn", filepath.Join(t.TempDir(), "failing.db"), "-file", file, "up"}
+	if code := run(args, stdout, stderr); code != exitError {
+		t.Fatalf("expected exit code %v but got %v", exitError, code)
+	}
+	partial := struct {
+		Applied []migrationOutput
+		Version int
+		Error   string
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &partial); err != nil {
+		t.Fatalf("could not parse output: %s\n%s", err, stdout)
+	}
+	if len(partial.Applied) != 1 || partial.Version != 1 || partial.Error == "" {
+		t.Errorf("expected 1 applied migration, version 1 and an error but got %+v", partial)
+	}
+}
+
+func TestRunCreate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "migrations.yml")
+	b, err := os.ReadFile("../../testdata/migrations.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := run([]string{"-file", file, "create", "Add", "users"}, stdout, stderr); code != exitOK {
+		t.Fatalf("expected exit code %v but got %v: %s", exitOK, code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "created migration with version 3") {
+		t.Errorf("expected version 3 in output but got %s", stdout)
+	}
+	if code := run([]string{"-file", file, "create", "-timestamp", "With ID"}, stdout, stderr); code != exitError {
+		t.Errorf("expected exit code %v when adding an ID to migrations without IDs but got %v", exitError, code)
+	}
+}
@@ -0,0 +1,194 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CreateMigration appends a new migration with comment and empty up and down statements to
+// the migrations YAML-file filename and returns the version it will receive. If id is not 0 it
+// is used as the ID of the new migration, this is required if the existing migrations has IDs.
+// The file is created if it does not exist. The new migration is inserted after the last one
+// using the same indentation, the rest of the file is left as is. Migrations written as a flow
+// sequence, [...], can not be appended to.
+func CreateMigration(filename, comment string, id int) (int, error) {
+	mode := fs.FileMode(0o644)
+	b, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	if fi, err := os.Stat(filename); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	b, version, err := appendMigration(b, comment, id)
+	if err != nil {
+		return 0, err
+	}
+	return version, os.WriteFile(filename, b, mode)
+}
+
+// appendMigration appends a migration stub to the migrations YAML-document b, returning the new
+// document and the version of the new migration. The stub is inserted as text, positioned using
+// the document node tree, to keep the formatting and comments of the document.
+func appendMigration(b []byte, comment string, id int) ([]byte, int, error) {
+	existing := Migrations{}
+	if err := yaml.Unmarshal(b, &existing); err != nil {
+		return nil, 0, err
+	}
+	existing.enumerateMigrations()
+	version, err := existing.nextVersion(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, 0, err
+	}
+	lines := strings.Split(string(b), "\n")
+	switch {
+	case len(doc.Content) == 0:
+		lines = appendLines(lines, "migrations:")
+		lines = appendLines(lines, stubLines(2, 2, comment, id)...)
+	case doc.Content[0].Kind != yaml.MappingNode:
+		return nil, 0, errors.New("migrator: migrations file must be a mapping with the key migrations")
+	default:
+		if lines, err = insertStub(lines, doc.Content[0], comment, id); err != nil {
+			return nil, 0, err
+		}
+	}
+	out := strings.Join(lines, "\n")
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+
+	// make sure the stub ended up in the list of migrations
+	appended := Migrations{}
+	if err := yaml.Unmarshal([]byte(out), &appended); err != nil || len(appended.Migrations) != len(existing.Migrations)+1 {
+		return nil, 0, errors.New("migrator: could not append the migration to the migrations file, add it manually")
+	}
+	return []byte(out), version, nil
+}
+
+// insertStub inserts a migration stub into lines, the document with the mapping root, after the
+// last migration.
+func insertStub(lines []string, root *yaml.Node, comment string, id int) ([]string, error) {
+	key, seq, next := mappingEntry(root, "migrations")
+	indent := root.Column - 1
+	switch {
+	case seq == nil:
+		lines = appendLines(lines, strings.Repeat(" ", indent)+"migrations:")
+		return appendLines(lines, stubLines(indent+2, 2, comment, id)...), nil
+	case seq.Tag == "!!null" || (seq.Kind == yaml.SequenceNode && len(seq.Content) == 0):
+		// replace an empty value, like null, ~ or [], with a block sequence
+		if seq.Line != key.Line {
+			return nil, errors.New("migrator: the value of migrations must be on the same line as the key")
+		}
+		line := lines[key.Line-1]
+		lines[key.Line-1] = strings.TrimRight(line[:min(seq.Column-1, len(line))], " ")
+		return slices.Insert(lines, key.Line, stubLines(indent+2, 2, comment, id)...), nil
+	case seq.Kind != yaml.SequenceNode:
+		return nil, errors.New("migrator: migrations in migrations file must be a list")
+	case seq.Style&yaml.FlowStyle != 0:
+		return nil, errors.New("migrator: can not append to migrations written as a flow sequence, use a block sequence")
+	}
+	dash := seq.Column - 1
+	first, last := seq.Content[0], seq.Content[len(seq.Content)-1]
+	// insert before blank lines and less indented comments following the last migration
+	end := len(lines)
+	if next != nil {
+		end = next.Line - 1
+	}
+	for end > 0 && trailingLine(lines[end-1], dash) {
+		end--
+	}
+	stub := stubLines(dash, max(first.Column-seq.Column, 2), comment, id)
+	// keep blank lines between migrations
+	if len(seq.Content) > 1 && last.Line > 1 && strings.TrimSpace(lines[last.Line-2]) == "" {
+		stub = append([]string{""}, stub...)
+	}
+	return slices.Insert(lines, end, stub...), nil
+}
+
+// mappingEntry returns the key and value of key in the mapping node n and the key following
+// it, nil if not found.
+func mappingEntry(n *yaml.Node, key string) (*yaml.Node, *yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			if i+2 < len(n.Content) {
+				return n.Content[i], n.Content[i+1], n.Content[i+2]
+			}
+			return n.Content[i], n.Content[i+1], nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// trailingLine returns true if line is blank or a comment indented less than indent.
+func trailingLine(line string, indent int) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || (strings.HasPrefix(trimmed, "#") && len(line)-len(strings.TrimLeft(line, " ")) < indent)
+}
+
+// appendLines appends add to lines, the lines of a document, keeping a final newline.
+func appendLines(lines []string, add ...string) []string {
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return append(append(lines, add...), "")
+}
+
+// stubLines returns the lines of a migration stub with the sequence indicator indented by
+// indent and the keys by indent+offset.
+func stubLines(indent, offset int, comment string, id int) []string {
+	fields := []string{}
+	if id != 0 {
+		fields = append(fields, fmt.Sprintf("id: %v", id))
+	}
+	fields = append(fields, "comment: "+strconv.Quote(comment), `up: ""`, `down: ""`)
+	lines := []string{}
+	for i, f := range fields {
+		prefix := strings.Repeat(" ", indent+offset)
+		if i == 0 {
+			prefix = strings.Repeat(" ", indent) + "-" + strings.Repeat(" ", offset-1)
+		}
+		lines = append(lines, prefix+f)
+	}
+	return lines
+}
+
+// nextVersion returns the version a migration appended with id will receive.
+func (ms Migrations) nextVersion(id int) (int, error) {
+	if err := ms.validateIDs(); err != nil {
+		return 0, err
+	}
+	if len(ms.Migrations) == 0 {
+		if id < 0 {
+			return 0, fmt.Errorf("migrator: \"id\" must be greater than 0 but was %v", id)
+		}
+		if id == 0 {
+			return 1, nil
+		}
+		return id, nil
+	}
+	hasIDs := ms.Migrations[0].ID != 0
+	switch {
+	case hasIDs && id == 0:
+		return 0, errors.New("migrator: the existing migrations has IDs, an ID is required")
+	case !hasIDs && id != 0:
+		return 0, errors.New("migrator: the existing migrations has no IDs, an ID is not allowed")
+	case !hasIDs:
+		return len(ms.Migrations) + 1, nil
+	}
+	if latest := ms.latest(); id <= latest {
+		return 0, fmt.Errorf("migrator: \"id\" must be greater than the last ID %v but was %v", latest, id)
+	}
+	return id, nil
+}
@@ -0,0 +1,135 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCreateMigration(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "migrations.yml")
+	original := `# migrations of the test database
+migrations:
+  # the first table
+  - comment: "My first migration"
+    up: >
+      CREATE TABLE test (id INTEGER PRIMARY KEY)
+    down: DROP TABLE test
+`
+	if err := os.WriteFile(filename, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	version, err := CreateMigration(filename, "Add users", 0)
+	if err != nil {
+		t.Fatalf("error while creating migration: %s", err)
+	}
+	if version != 2 {
+		t.Errorf("expected version 2 but got %v", version)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# migrations of the test database", "# the first table"} {
+		if !strings.Contains(string(b), comment) {
+			t.Errorf("expected comment %q to be preserved but got:\n%s", comment, b)
+		}
+	}
+	ms := Migrations{}
+	if err := yaml.Unmarshal(b, &ms); err != nil {
+		t.Fatalf("could not parse created file: %s", err)
+	}
+	if len(ms.Migrations) != 2 || ms.Migrations[1].Comment != "Add users" || ms.Migrations[0].Up != "CREATE TABLE test (id INTEGER PRIMARY KEY)\n" {
+		t.Errorf("unexpected migrations after create: %+v", ms.Migrations)
+	}
+	if _, err := CreateMigration(filename, "With ID", 20240101); err == nil {
+		t.Errorf("expected an error when adding an ID to migrations without IDs")
+	}
+}
+
+func TestAppendMigrationIDs(t *testing.T) {
+	cases := []struct {
+		Document string
+		ID       int
+		Version  int
+		Valid    bool
+	}{
+		{Document: "", ID: 0, Version: 1, Valid: true},
+		{Document: "migrations: []", ID: 20240101, Version: 20240101, Valid: true},
+		{Document: "migrations:\n  - id: 5\n    up: a\n", ID: 7, Version: 7, Valid: true},
+		{Document: "migrations:\n  - id: 5\n    up: a\n", ID: 5, Valid: false},
+		{Document: "migrations:\n  - id: 5\n    up: a\n", ID: 0, Valid: false},
+		{Document: "- up: a", ID: 0, Valid: false},
+	}
+	for i, tc := range cases {
+		b, version, err := appendMigration([]byte(tc.Document), "new", tc.ID)
+		if (err == nil) != tc.Valid {
+			t.Errorf("%v: expected valid to be %v but got error %v", i, tc.Valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if version != tc.Version {
+			t.Errorf("%v: expected version %v but got %v", i, tc.Version, version)
+		}
+		ms := Migrations{}
+		if err := yaml.Unmarshal(b, &ms); err != nil {
+			t.Fatalf("%v: could not parse created document: %s", i, err)
+		}
+		ms.enumerateMigrations()
+		if last := ms.Migrations[len(ms.Migrations)-1]; last.Version() != tc.Version || last.Comment != "new" {
+			t.Errorf("%v: expected new migration with version %v but got %+v", i, tc.Version, last)
+		}
+	}
+}
+
+func TestAppendMigrationFormatting(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Document string
+		Expected string
+	}{
+		{
+			Name:     "four spaces and blank lines",
+			Document: "migrations:\n    - comment: a\n      up: A\n\n    - comment: b\n      up: B\n\n# trailing comment\n",
+			Expected: "migrations:\n    - comment: a\n      up: A\n\n    - comment: b\n      up: B\n\n    - comment: \"new\"\n      up: \"\"\n      down: \"\"\n\n# trailing comment\n",
+		},
+		{
+			Name:     "followed by key",
+			Document: "migrations:\n- comment: a\n  up: A\nother: 1\n",
+			Expected: "migrations:\n- comment: a\n  up: A\n- comment: \"new\"\n  up: \"\"\n  down: \"\"\nother: 1\n",
+		},
+		{
+			Name:     "null",
+			Document: "# header\nmigrations:\n",
+			Expected: "# header\nmigrations:\n  - comment: \"new\"\n    up: \"\"\n    down: \"\"\n",
+		},
+		{
+			Name:     "empty list",
+			Document: "migrations: []",
+			Expected: "migrations:\n  - comment: \"new\"\n    up: \"\"\n    down: \"\"\n",
+		},
+		{
+			Name:     "empty",
+			Document: "",
+			Expected: "migrations:\n  - comment: \"new\"\n    up: \"\"\n    down: \"\"\n",
+		},
+	}
+	for _, tc := range cases {
+		b, _, err := appendMigration([]byte(tc.Document), "new", 0)
+		if err != nil {
+			t.Errorf("%s: error while appending migration: %s", tc.Name, err)
+			continue
+		}
+		if string(b) != tc.Expected {
+			t.Errorf("%s: expected:\n%s\nbut got:\n%s", tc.Name, tc.Expected, b)
+		}
+	}
+	if _, _, err := appendMigration([]byte("migrations: [{up: a}]"), "new", 0); err == nil {
+		t.Errorf("expected an error when appending to a flow sequence")
+	}
+}
@@ -0,0 +1,252 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	tableVersion   = "_migrator_"
+	tableChecksums = "_migrator_checksums_"
+	tableHistory   = "_migrator_history_"
+	tableLock      = "_migrator_lock_"
+)
+
+// plainIdentifier matches identifiers that does not need to be quoted.
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Execer executes statements, it is implemented by both *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Dialect is the database specific part of a Migrator. Migrator ships with Sqlite and Postgres,
+// implement Dialect and pass it to New to run migrations against other databases.
+//
+// A Dialect creates the metadata tables named by Metadata and reads and writes the version.
+// Migrator itself reads and writes the dirty flag, checksums and history using statements
+// built with QuoteIdentifier and Placeholder, see Metadata for the columns it expects.
+type Dialect interface {
+	// DefaultSchema returns the schema of the metadata tables if none is given with WithSchema,
+	// empty if the table names should not be qualified with a schema.
+	DefaultSchema() string
+	// QuoteIdentifier returns name, a table or schema name, quoted for use in statements.
+	QuoteIdentifier(name string) string
+	// Placeholder returns the placeholder for the n:th argument of a statement, starting at 1.
+	Placeholder(n int) string
+	// Init creates the metadata tables that does not exist and sets version 0 in a new
+	// version table. Tables created by earlier releases of the Dialect must be upgraded. Init
+	// is called while holding the migration lock.
+	Init(ctx context.Context, db *sql.DB, md Metadata) error
+	// Initialized returns true if the version table exists and, as upToDate, if all metadata
+	// tables exist as created by Init of this release. Init is not called for an up to date
+	// database.
+	Initialized(ctx context.Context, db *sql.DB, md Metadata) (initialized bool, upToDate bool, err error)
+	// Version returns the version stored in the version table.
+	Version(ctx context.Context, db *sql.DB, md Metadata) (int, error)
+	// SetVersion stores version in the version table. e is a transaction while migrating and a
+	// recorder when planning, all changes must be made with it.
+	SetVersion(ctx context.Context, e Execer, md Metadata, version int) error
+	// Lock acquires the migration lock, shared by all processes migrating the database, waiting
+	// at most timeout before returning ErrLockTimeout. The returned function releases the lock.
+	// Lock is called before Init when a new database is initialized, it must not depend on the
+	// tables created by Init.
+	Lock(ctx context.Context, db *sql.DB, md Metadata, timeout time.Duration) (func() error, error)
+	// Unlock releases a migration lock left behind by a process that crashed while holding it.
+	Unlock(ctx context.Context, db *sql.DB, md Metadata) error
+}
+
+// Metadata holds the names of the tables migrator keeps its state in, quoted and qualified with
+// the schema using QuoteIdentifier of the Dialect.
+type Metadata struct {
+	// Schema is the schema of the tables as given with WithSchema, or the default schema of
+	// the Dialect. It is not quoted.
+	Schema string
+	// Version is the table holding a single row with the current version in the column
+	// version and the version of a migration that failed midway, or 0, in the column dirty.
+	Version string
+	// Checksums is the table holding the checksums of applied migrations in the columns
+	// version, the primary key, and checksum.
+	Checksums string
+	// History is the table with the columns version, direction, comment, checksum,
+	// started_at, finished_at, success and error. Its column id orders the entries. The times
+	// are written as time.Time values.
+	History string
+	// Lock is a table the Dialect may use to implement Lock.
+	Lock string
+}
+
+func newMetadata(d Dialect, schema string) Metadata {
+	table := func(name string) string {
+		if schema == "" {
+			return d.QuoteIdentifier(name)
+		}
+		return d.QuoteIdentifier(schema) + "." + d.QuoteIdentifier(name)
+	}
+	return Metadata{
+		Schema:    schema,
+		Version:   table(tableVersion),
+		Checksums: table(tableChecksums),
+		History:   table(tableHistory),
+		Lock:      table(tableLock),
+	}
+}
+
+// quoteIdentifier quotes name with double quotes, as defined by the SQL standard, unless it is
+// a lower case identifier that does not need to be quoted.
+func quoteIdentifier(name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (b base) init(ctx context.Context) error {
+	return b.dialect.Init(ctx, b.db, b.md)
+}
+
+func (b base) initialized(ctx context.Context) (bool, error) {
+	initialized, _, err := b.dialect.Initialized(ctx, b.db, b.md)
+	return initialized, err
+}
+
+// version returns the current version from the database without verifying checksums.
+func (b base) version(ctx context.Context) (int, error) {
+	initialized, err := b.initialized(ctx)
+	if err != nil {
+		return -1, err
+	}
+	if !initialized {
+		return 0, ErrMigratorNotInitialized
+	}
+	return b.dialect.Version(ctx, b.db, b.md)
+}
+
+func (b base) setVersion(ctx context.Context, e Execer, version int) error {
+	return b.dialect.SetVersion(ctx, e, b.md, version)
+}
+
+// dirty returns the version of a migration that failed midway, 0 if the database is clean.
+func (b base) dirty(ctx context.Context) (int, error) {
+	row := b.db.QueryRowContext(ctx, fmt.Sprintf("SELECT dirty FROM %s", b.md.Version))
+	dirty := 0
+	if err := row.Scan(&dirty); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		if err := b.readOutdated(err); err != nil {
+			return -1, err
+		}
+		return 0, nil
+	}
+	return dirty, nil
+}
+
+// readOutdated returns err, from reading the dirty flag, checksums or history, unless the
+// metadata tables were created by an earlier release and not upgraded since it is a dry run. The
+// column or table read is then assumed to be missing and read as empty, a clean database without
+// checksums or history, like Init would have created it.
+func (b base) readOutdated(err error) error {
+	if b.outdated {
+		return nil
+	}
+	return err
+}
+
+// setDirty marks the database as dirty while running the migration with the given version, 0
+// clears it.
+func (b base) setDirty(ctx context.Context, e Execer, version int) error {
+	stmt := fmt.Sprintf("UPDATE %s SET dirty = %s", b.md.Version, b.dialect.Placeholder(1))
+	_, err := e.ExecContext(ctx, stmt, version)
+	return err
+}
+
+// checksums returns the stored checksums of applied migrations by version.
+func (b base) checksums(ctx context.Context) (map[int]string, error) {
+	rows, err := b.db.QueryContext(ctx, fmt.Sprintf("SELECT version, checksum FROM %s", b.md.Checksums))
+	if err != nil {
+		return map[int]string{}, b.readOutdated(err)
+	}
+	defer rows.Close()
+	checksums := map[int]string{}
+	for rows.Next() {
+		version, checksum := 0, ""
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[version] = checksum
+	}
+	return checksums, rows.Err()
+}
+
+// setChecksum stores the checksum for an applied migration, replacing any stored checksum. It
+// deletes and inserts since upserts are not portable.
+func (b base) setChecksum(ctx context.Context, e Execer, version int, checksum string) error {
+	if err := b.deleteChecksum(ctx, e, version); err != nil {
+		return err
+	}
+	p := b.dialect.Placeholder
+	stmt := fmt.Sprintf("INSERT INTO %s (version, checksum) VALUES (%s, %s)", b.md.Checksums, p(1), p(2))
+	_, err := e.ExecContext(ctx, stmt, version, checksum)
+	return err
+}
+
+// deleteChecksum removes the stored checksum for a migration.
+func (b base) deleteChecksum(ctx context.Context, e Execer, version int) error {
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE version = %s", b.md.Checksums, b.dialect.Placeholder(1))
+	_, err := e.ExecContext(ctx, stmt, version)
+	return err
+}
+
+// addHistory appends an entry to the history table.
+func (b base) addHistory(ctx context.Context, e HistoryEntry) error {
+	p := b.dialect.Placeholder
+	stmt := fmt.Sprintf("INSERT INTO %s (version, direction, comment, checksum, started_at, finished_at, success, error) VALUES (%s, %s, %s, %s, %s, %s, %s, %s)",
+		b.md.History, p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8))
+	_, err := b.db.ExecContext(ctx, stmt, e.Version, e.Direction, e.Comment, e.Checksum, b.timeValue(e.StartedAt), b.timeValue(e.FinishedAt), e.Success, e.Error)
+	return err
+}
+
+// textTimes is implemented by dialects storing times as RFC 3339 text instead of in a
+// timestamp column.
+type textTimes interface {
+	textTimes()
+}
+
+// timeValue returns t as the value bound to a statement, RFC 3339 text for dialects
+// implementing textTimes.
+func (b base) timeValue(t time.Time) any {
+	if _, ok := b.dialect.(textTimes); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return t
+}
+
+// lock acquires the migration lock, waiting at most timeout. The returned function releases
+// the lock.
+func (b base) lock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	return b.dialect.Lock(ctx, b.db, b.md, timeout)
+}
+
+// timeScanner scans times stored either in a timestamp column or as RFC 3339 text, see
+// textTimes.
+type timeScanner struct {
+	t *time.Time
+}
+
+func (s timeScanner) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case time.Time:
+		*s.t = v
+	case string:
+		*s.t, err = time.Parse(time.RFC3339Nano, v)
+	case []byte:
+		*s.t, err = time.Parse(time.RFC3339Nano, string(v))
+	default:
+		err = fmt.Errorf("migrator: can not scan %T into a time", src)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingDialect is a third party Dialect built on SqliteDialect counting calls to Lock.
+type countingDialect struct {
+	SqliteDialect
+	locks *int
+}
+
+func (d countingDialect) Lock(ctx context.Context, db *sql.DB, md Metadata, timeout time.Duration) (func() error, error) {
+	*d.locks++
+	return d.SqliteDialect.Lock(ctx, db, md, timeout)
+}
+
+func TestCustomDialect(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	locks := 0
+	m, err := New(db, countingDialect{locks: &locks}, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, err := m.Version(); err != nil || v != 2 {
+		t.Errorf("expected version 2 but got %v: %v", v, err)
+	}
+	// once when initializing and once when migrating
+	if locks != 2 {
+		t.Errorf("expected the lock of the dialect to be acquired twice but was %v", locks)
+	}
+	history, err := m.History()
+	if err != nil {
+		t.Fatalf("error while reading history: %s", err)
+	}
+	if len(history) != 2 || history[1].StartedAt.IsZero() {
+		t.Errorf("expected 2 history entries with times but got %+v", history)
+	}
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	// keep a single connection, the attached database only exists on the connection attaching it
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("ATTACH DATABASE ?1 AS \"Meta Data\"", filepath.Join(t.TempDir(), "meta.db")); err != nil {
+		t.Fatal(err)
+	}
+	migrations := Migrations{Migrations: []Migration{{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithSchema("Meta Data"))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	version := 0
+	if err := db.QueryRow(`SELECT version FROM "Meta Data"._migrator_`).Scan(&version); err != nil || version != 1 {
+		t.Errorf("expected version 1 in the attached database but got %v: %v", version, err)
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM main.sqlite_master WHERE name LIKE '_migrator_%'").Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected no metadata tables in the main database but got %v: %v", count, err)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"_migrator_": "_migrator_",
+		"public":     "public",
+		"MySchema":   `"MySchema"`,
+		`a"b`:        `"a""b"`,
+		"1st":        `"1st"`,
+	}
+	for name, expected := range cases {
+		if quoted := quoteIdentifier(name); quoted != expected {
+			t.Errorf("expected %s to be quoted as %s but got %s", name, expected, quoted)
+		}
+	}
+}
+
+func TestTimeScanner(t *testing.T) {
+	expected := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	for _, src := range []any{expected, expected.Format(time.RFC3339Nano), []byte(expected.Format(time.RFC3339Nano))} {
+		got := time.Time{}
+		if err := (timeScanner{&got}).Scan(src); err != nil {
+			t.Fatalf("error while scanning %v: %s", src, err)
+		}
+		if !got.Equal(expected) {
+			t.Errorf("expected %v but got %v", expected, got)
+		}
+	}
+	if err := (timeScanner{&time.Time{}}).Scan(42); err == nil {
+		t.Errorf("expected an error when scanning an int")
+	}
+}
+
+func TestSQLiteHistoryTimes(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	startedAt := ""
+	if err := db.QueryRow("SELECT started_at FROM _migrator_history_").Scan(&startedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, startedAt); err != nil {
+		t.Errorf("expected started_at to be stored as RFC 3339 text but got %q", startedAt)
+	}
+}
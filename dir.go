@@ -0,0 +1,128 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sqlFilePattern matches migration files named like 0001_create_users.up.sql, the same layout
+// as used by golang-migrate.
+var sqlFilePattern = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+
+type sqlFiles struct {
+	name string
+	up   string
+	down string
+}
+
+// LoadMigrationsDir reads migrations from a directory in fsys with one SQL file per version and
+// direction, named like 0001_create_users.up.sql and 0001_create_users.down.sql. Versions
+// starting at 1 are sequential and must not have any gaps. Other versions, like timestamps in
+// 20240101120000_create_users.up.sql, are used as the ID of each migration. The comment of each
+// migration is derived from its filename, create users in the example above. Files not matching
+// the pattern are ignored.
+func LoadMigrationsDir(fsys fs.FS, dir string) (Migrations, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return Migrations{}, err
+	}
+
+	files := map[int]*sqlFiles{}
+	errs := []error{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		match := sqlFilePattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migrator: invalid version in filename %s: %w", e.Name(), err))
+			continue
+		}
+		f, found := files[version]
+		if !found {
+			f = &sqlFiles{name: match[2]}
+			files[version] = f
+		}
+		if f.name != match[2] {
+			errs = append(errs, fmt.Errorf("migrator: duplicate migration files for version %v: %s and %s", version, f.name, match[2]))
+			continue
+		}
+		filename := &f.up
+		if match[3] == "down" {
+			filename = &f.down
+		}
+		if *filename != "" {
+			errs = append(errs, fmt.Errorf("migrator: duplicate %s migration files for version %v: %s and %s", match[3], version, *filename, e.Name()))
+			continue
+		}
+		*filename = e.Name()
+	}
+
+	versions := []int{}
+	for v := range files {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+
+	// versions starting at 1 are numbered sequentially, other versions are IDs
+	sequential := len(versions) > 0 && versions[0] == 1
+	migrations := Migrations{}
+	prev := 0
+	for _, v := range versions {
+		f := files[v]
+		if sequential && v != prev+1 {
+			errs = append(errs, missingVersionsError(prev+1, v-1))
+		}
+		prev = v
+		if f.up == "" {
+			errs = append(errs, fmt.Errorf("migrator: down migration file %s has no matching up migration file", f.down))
+			continue
+		}
+		m := Migration{Comment: strings.ReplaceAll(f.name, "_", " ")}
+		if !sequential {
+			m.ID = v
+		}
+		if m.Up, err = readSQLFile(fsys, dir, f.up); err != nil {
+			errs = append(errs, err)
+		}
+		if f.down != "" {
+			if m.Down, err = readSQLFile(fsys, dir, f.down); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		migrations.Migrations = append(migrations.Migrations, m)
+	}
+	if len(errs) > 0 {
+		return Migrations{}, errors.Join(errs...)
+	}
+	migrations.enumerateMigrations()
+	return migrations, migrations.validate(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Join(dir, name))
+	})
+}
+
+// missingVersionsError returns an error for the missing versions from and to, inclusive.
+func missingVersionsError(from, to int) error {
+	if from == to {
+		return fmt.Errorf("migrator: missing migration files for version %v", from)
+	}
+	return fmt.Errorf("migrator: missing migration files for versions %v to %v", from, to)
+}
+
+func readSQLFile(fsys fs.FS, dir, name string) (string, error) {
+	b, err := fs.ReadFile(fsys, path.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
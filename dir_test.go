@@ -0,0 +1,108 @@
+package migrator
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrationsDir(t *testing.T) {
+	m, err := LoadMigrationsDir(os.DirFS("testdata"), "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Migrations) != 2 {
+		t.Fatalf("expected %v migrations but got %v", 2, len(m.Migrations))
+	}
+	if m.Migrations[1].Comment != "create address" {
+		t.Errorf("expected %s but got %s", "create address", m.Migrations[1].Comment)
+	}
+	if m.Migrations[1].Version() != 2 {
+		t.Errorf("expected version %v but got %v", 2, m.Migrations[1].Version())
+	}
+	if strings.TrimSpace(m.Migrations[0].Down) != "DROP TABLE users;" {
+		t.Errorf("expected %s but got %s", "DROP TABLE users;", m.Migrations[0].Down)
+	}
+}
+
+func TestLoadMigrationsDirInvalid(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1")}
+	cases := []struct {
+		Name string
+		FS   fstest.MapFS
+	}{
+		{
+			Name: "gap",
+			FS:   fstest.MapFS{"sql/1_a.up.sql": file, "sql/3_c.up.sql": file},
+		},
+		{
+			Name: "duplicate",
+			FS:   fstest.MapFS{"sql/1_a.up.sql": file, "sql/01_a.up.sql": file},
+		},
+		{
+			Name: "duplicate name",
+			FS:   fstest.MapFS{"sql/1_a.up.sql": file, "sql/1_b.down.sql": file},
+		},
+		{
+			Name: "orphaned down",
+			FS:   fstest.MapFS{"sql/1_a.up.sql": file, "sql/2_b.down.sql": file},
+		},
+		{
+			Name: "empty up",
+			FS:   fstest.MapFS{"sql/1_a.up.sql": &fstest.MapFile{Data: []byte(" ")}},
+		},
+	}
+	for _, tc := range cases {
+		if _, err := LoadMigrationsDir(tc.FS, "sql"); err == nil {
+			t.Errorf("%s: expected and error but the error was <nil>", tc.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsDirGap(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1")}
+	fsys := fstest.MapFS{"sql/1_a.up.sql": file, "sql/3_c.up.sql": file, "sql/4_d.up.sql": file, "sql/7_g.up.sql": file}
+	_, err := LoadMigrationsDir(fsys, "sql")
+	expected := "migrator: missing migration files for version 2\nmigrator: missing migration files for versions 5 to 6"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error:\n%s\nbut got:\n%v", expected, err)
+	}
+}
+
+func TestLoadMigrationsDirTimestamps(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1")}
+	fsys := fstest.MapFS{
+		"sql/20240101120000_create_users.up.sql":   file,
+		"sql/20240101120000_create_users.down.sql": file,
+		"sql/20240315093000_create_address.up.sql": file,
+	}
+	m, err := LoadMigrationsDir(fsys, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Migrations) != 2 {
+		t.Fatalf("expected %v migrations but got %v", 2, len(m.Migrations))
+	}
+	for i, expected := range []int{20240101120000, 20240315093000} {
+		if m.Migrations[i].ID != expected || m.Migrations[i].Version() != expected {
+			t.Errorf("expected ID and version %v but got %v and %v", expected, m.Migrations[i].ID, m.Migrations[i].Version())
+		}
+	}
+}
+
+func TestWithDir(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	m, err := New(db, Sqlite, WithDir(os.DirFS("testdata"), "sql"), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := m.Migrate()
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 2 {
+		t.Errorf("expected to have run 2 migrations but ran %v", len(ran))
+	}
+}
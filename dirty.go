@@ -0,0 +1,71 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrDirty = errors.New("migrator: database is dirty")
+
+// DirtyError is returned by Migrate when a migration run outside of a transaction failed midway,
+// leaving the database in an unknown state. Fix the database manually and call Force to clear
+// it. DirtyError matches ErrDirty using errors.Is.
+type DirtyError struct {
+	// Version is the version of the migration that failed.
+	Version int
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migrator: database is dirty, migration of version %v failed midway, fix the database manually and call Force", e.Version)
+}
+
+func (e *DirtyError) Unwrap() error {
+	return ErrDirty
+}
+
+// checkDirty returns a *DirtyError if the database is dirty.
+func (b base) checkDirty(ctx context.Context) error {
+	dirty, err := b.dirty(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty != 0 {
+		return &DirtyError{Version: dirty}
+	}
+	return nil
+}
+
+// force sets the version without running any migrations and clears the dirty flag. Checksums
+// of migrations after version are removed.
+func (b base) force(ctx context.Context, version int) error {
+	pos, found := b.migrations.position(version)
+	if !found {
+		return fmt.Errorf("%w: %v", ErrUnknownVersion, version)
+	}
+	return b.withLock(ctx, func() error {
+		stored, err := b.checksums(ctx)
+		if err != nil {
+			return err
+		}
+		tx, err := b.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := b.setVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		if err := b.setDirty(ctx, tx, 0); err != nil {
+			return err
+		}
+		for v := range stored {
+			if p, found := b.migrations.position(v); !found || p > pos {
+				if err := b.deleteChecksum(ctx, tx, v); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Commit()
+	})
+}
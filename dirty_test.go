@@ -0,0 +1,79 @@
+package migrator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSQLiteDirty(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Up: "CREATE TABLE b (id INTEGER); CREATE TABLE", Down: "DROP TABLE b", NoTransaction: true},
+		{Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err == nil {
+		t.Fatalf("expected and error but the error was <nil>")
+	}
+
+	// the failing migration left table b behind, the database is dirty
+	_, err = m.Migrate()
+	var dirtyErr *DirtyError
+	if !errors.As(err, &dirtyErr) {
+		t.Fatalf("expected a *DirtyError but got %v", err)
+	}
+	if dirtyErr.Version != 2 {
+		t.Errorf("expected dirty version 2 but got %v", dirtyErr.Version)
+	}
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("expected error to match %v", ErrDirty)
+	}
+	if v, _ := m.Version(); v != 1 {
+		t.Errorf("expected version to be 1 but was %v", v)
+	}
+
+	if err := m.Force(5); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected %v but got %v", ErrUnknownVersion, err)
+	}
+	// operator finishes migration 2 manually and forces the version
+	if err := m.Force(2); err != nil {
+		t.Fatalf("error while running Force: %s", err)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Errorf("expected version to be 2 after Force but was %v", v)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 3 {
+		t.Errorf("expected version to be 3 but was %v", v)
+	}
+}
+
+func TestSQLiteDirtyUpgrade(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	// version table created by a release without the dirty column
+	if _, err := db.Exec("CREATE TABLE _migrator_ (version INTEGER NOT NULL) STRICT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO _migrator_ (version) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	migrations := Migrations{Migrations: []Migration{{Up: "SELECT 1"}, {Up: "SELECT 2"}}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Errorf("expected version to be 2 but was %v", v)
+	}
+}
@@ -0,0 +1,52 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// unlimitedDown allows downgrades of any number of migrations.
+const unlimitedDown = -1
+
+var ErrDowngrade = errors.New("migrator: downgrade not allowed")
+
+// DowngradeError is returned by Migrate when the target version is lower than the current version
+// and downgrades has not been allowed with WithAllowDown, WithMaxDownSteps or the environment
+// variable MIGRATOR_ALLOW_DOWN, or when the downgrade reverts more migrations than allowed. No
+// migrations are run. DowngradeError matches ErrDowngrade using errors.Is.
+type DowngradeError struct {
+	// Version is the current version of the database.
+	Version int
+	// Target is the version the database would have been downgraded to.
+	Target int
+	// Versions are the versions of the migrations the downgrade would revert, in the order
+	// they would be reverted.
+	Versions []int
+	// MaxSteps is the number of migrations allowed to be reverted, 0 if downgrades are not
+	// allowed.
+	MaxSteps int
+}
+
+func (e *DowngradeError) Error() string {
+	if e.MaxSteps == 0 {
+		return fmt.Sprintf("migrator: downgrade from version %v to %v would revert versions %v, downgrades are not allowed", e.Version, e.Target, e.Versions)
+	}
+	return fmt.Sprintf("migrator: downgrade from version %v to %v would revert versions %v, at most %v migrations are allowed to be reverted", e.Version, e.Target, e.Versions, e.MaxSteps)
+}
+
+func (e *DowngradeError) Unwrap() error {
+	return ErrDowngrade
+}
+
+// checkDowngrade returns a *DowngradeError if migrating tms in direction dir from version v
+// reverts more migrations than allowed.
+func (b base) checkDowngrade(v int, tms []Migration, dir direction) error {
+	if dir != directionDown || b.maxDown == unlimitedDown || len(tms) <= b.maxDown {
+		return nil
+	}
+	e := &DowngradeError{Version: v, Target: b.target, Versions: []int{}, MaxSteps: b.maxDown}
+	for _, tm := range tms {
+		e.Versions = append(e.Versions, tm.version)
+	}
+	return e
+}
@@ -0,0 +1,95 @@
+package migrator
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSQLiteDowngrade(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Comment: "c", Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithLatest())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	// downgrades are not allowed by default
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := m.Migrate()
+	var downgradeErr *DowngradeError
+	if !errors.As(err, &downgradeErr) {
+		t.Fatalf("expected a *DowngradeError but got %v", err)
+	}
+	if downgradeErr.Version != 3 || downgradeErr.Target != 1 || !slices.Equal(downgradeErr.Versions, []int{3, 2}) {
+		t.Errorf("expected downgrade from 3 to 1 reverting [3 2] but got %v to %v reverting %v", downgradeErr.Version, downgradeErr.Target, downgradeErr.Versions)
+	}
+	if len(ran) != 0 {
+		t.Errorf("expected no migrations to run but got %v", len(ran))
+	}
+	// plan and dry run report the same error as Migrate
+	if _, err := m.Plan(); !errors.Is(err, ErrDowngrade) {
+		t.Errorf("expected %v from Plan but got %v", ErrDowngrade, err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithDryRun())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); !errors.Is(err, ErrDowngrade) {
+		t.Errorf("expected %v from dry run but got %v", ErrDowngrade, err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if p, err := m.Plan(); err != nil || len(p.Steps) != 2 {
+		t.Errorf("expected a plan with 2 steps but got %v, %v", len(p.Steps), err)
+	}
+
+	// more steps than allowed
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithMaxDownSteps(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); !errors.Is(err, ErrDowngrade) {
+		t.Errorf("expected %v but got %v", ErrDowngrade, err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithSteps(-1), WithMaxDownSteps(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	// allowed by the environment
+	os.Setenv(envVarAllowDown, "true")
+	defer os.Unsetenv(envVarAllowDown)
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(0), WithEnv())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version 0 but got %v", v)
+	}
+
+	os.Setenv(envVarAllowDown, "yes please")
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(0), WithEnv()); err == nil {
+		t.Errorf("expected an error for an invalid %s", envVarAllowDown)
+	}
+}
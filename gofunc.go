@@ -0,0 +1,64 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MigrationFunc is a migration implemented in Go, for example a data backfill that can not be
+// expressed in SQL. It runs in tx together with the update of the version.
+type MigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+type funcs struct {
+	up   MigrationFunc
+	down MigrationFunc
+}
+
+// fn returns the Go function to run in direction dir, nil if the migration has none.
+func (m Migration) fn(dir direction) MigrationFunc {
+	if m.funcs == nil {
+		return nil
+	}
+	switch dir {
+	case directionDown:
+		return m.funcs.down
+	case directionUp:
+		return m.funcs.up
+	}
+	return nil
+}
+
+// registerFuncs attaches the registered Go functions to their migrations and verifies that all
+// Go migrations has functions.
+func (ms Migrations) registerFuncs(registered map[int]*funcs) error {
+	for version, f := range registered {
+		pos, found := ms.position(version)
+		if !found || version == targetStart {
+			return fmt.Errorf("migrator: function registered for version %v but there is no migration with that version", version)
+		}
+		if !ms.Migrations[pos-1].Go {
+			return fmt.Errorf("migrator: function registered for version %v but the migration is not a Go migration", version)
+		}
+		ms.Migrations[pos-1].funcs = f
+	}
+	for _, m := range ms.Migrations {
+		if m.Go && m.funcs == nil {
+			return fmt.Errorf("migrator: version %v is a Go migration but no function has been registered for it", m.Version())
+		}
+	}
+	return nil
+}
+
+// runFunc runs the Go function fn of migration m within tx. When planning, e is a recorder
+// and a comment is recorded instead.
+func runFunc(ctx context.Context, e Execer, m Migration, fn MigrationFunc) error {
+	switch e := e.(type) {
+	case *sql.Tx:
+		return fn(ctx, e)
+	case *recorder:
+		e.stmts = append(e.stmts, fmt.Sprintf("-- Go function of version %v", m.Version()))
+		return nil
+	}
+	return fmt.Errorf("migrator: Go migration of version %v must run in a transaction", m.Version())
+}
@@ -0,0 +1,104 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteGoMigration(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	yml := `migrations:
+  - up: CREATE TABLE users (name TEXT)
+    down: DROP TABLE users
+  - comment: "Backfill users"
+    go: true
+  - up: ALTER TABLE users ADD COLUMN email TEXT
+    down: ALTER TABLE users DROP COLUMN email
+`
+	up := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (name) VALUES ('gopher')")
+		return err
+	}
+	down := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM users")
+		return err
+	}
+	m, err := New(db, Sqlite, WithReader(strings.NewReader(yml)), WithFunc(2, up, down), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	p, err := m.Plan()
+	if err != nil {
+		t.Fatalf("error while running Plan: %s", err)
+	}
+	if p.Steps[1].Statements[0] != "-- Go function of version 2" {
+		t.Errorf("expected Go function in plan but got %s", p.Steps[1].Statements[0])
+	}
+	calls := 0
+	ran, err := m.MigrateCallback(func(m Migration) { calls++ })
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 3 || calls != 3 {
+		t.Errorf("expected 3 migrations and callbacks but got %v and %v", len(ran), calls)
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 user after Go migration but got %v", count)
+	}
+
+	// a failing Go function is rolled back together with the version
+	m, err = New(db, Sqlite, WithReader(strings.NewReader(yml)), WithTarget(1), WithAllowDown(),
+		WithFunc(2, up, func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM users"); err != nil {
+				return err
+			}
+			return errors.New("backfill failed")
+		}))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	var migrationErr *MigrationError
+	if _, err := m.Migrate(); !errors.As(err, &migrationErr) || migrationErr.Version != 2 {
+		t.Fatalf("expected a *MigrationError for version 2 but got %v", err)
+	}
+	if v, _ := m.Version(); v != 2 {
+		t.Errorf("expected version to be 2 but was %v", v)
+	}
+	if err := db.QueryRow("SELECT COUNT(1) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected delete to be rolled back but found %v users", count)
+	}
+}
+
+func TestGoMigrationInvalid(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	noop := func(ctx context.Context, tx *sql.Tx) error { return nil }
+	cases := []struct {
+		Name string
+		YAML string
+		Opts []Option
+	}{
+		{Name: "missing function", YAML: "migrations:\n  - go: true\n"},
+		{Name: "unknown version", YAML: "migrations:\n  - go: true\n", Opts: []Option{WithFunc(1, noop, nil), WithFunc(2, noop, nil)}},
+		{Name: "not a Go migration", YAML: "migrations:\n  - up: SELECT 1\n", Opts: []Option{WithFunc(1, noop, nil)}},
+		{Name: "Go migration with statement", YAML: "migrations:\n  - go: true\n    up: SELECT 1\n", Opts: []Option{WithFunc(1, noop, nil)}},
+		{Name: "nil up function", YAML: "migrations:\n  - go: true\n", Opts: []Option{WithFunc(1, nil, nil)}},
+	}
+	for _, tc := range cases {
+		opts := append([]Option{WithReader(strings.NewReader(tc.YAML)), WithTarget(1)}, tc.Opts...)
+		if _, err := New(db, Sqlite, opts...); err == nil {
+			t.Errorf("%s: expected and error but the error was <nil>", tc.Name)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package migrator
+
+import "time"
+
+// HistoryEntry is a migration that has been run, successful or not, as recorded in the
+// history table.
+type HistoryEntry struct {
+	Version int
+	// Direction is either up, down or baseline.
+	Direction  string
+	Comment    string
+	Checksum   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Success    bool
+	// Error is the error message if the migration failed.
+	Error string
+}
+
+// Duration returns how long the migration took to run.
+func (e HistoryEntry) Duration() time.Duration {
+	return e.FinishedAt.Sub(e.StartedAt)
+}
@@ -0,0 +1,70 @@
+package migrator
+
+import "testing"
+
+func TestSQLiteHistory(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Comment: "broken", Up: "CREATE TABLE"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err == nil {
+		t.Fatalf("expected and error but the error was <nil>")
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatalf("error while running History: %s", err)
+	}
+	type Expected struct {
+		Version   int
+		Direction string
+		Comment   string
+		Success   bool
+	}
+	expected := []Expected{
+		{Version: 1, Direction: "up", Comment: "a", Success: true},
+		{Version: 2, Direction: "up", Comment: "b", Success: true},
+		{Version: 2, Direction: "down", Comment: "b", Success: true},
+		{Version: 2, Direction: "up", Comment: "b", Success: true},
+		{Version: 3, Direction: "up", Comment: "broken", Success: false},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %v history entries but got %v", len(expected), len(history))
+	}
+	for i, e := range history {
+		actual := Expected{Version: e.Version, Direction: e.Direction, Comment: e.Comment, Success: e.Success}
+		if actual != expected[i] {
+			t.Errorf("%v: expected %v but got %v", i, expected[i], actual)
+		}
+		if e.Checksum != migrations.Migrations[e.Version-1].Checksum() {
+			t.Errorf("%v: expected checksum %s but got %s", i, migrations.Migrations[e.Version-1].Checksum(), e.Checksum)
+		}
+		if e.StartedAt.IsZero() || e.Duration() < 0 {
+			t.Errorf("%v: expected valid timestamps but got %v and %v", i, e.StartedAt, e.FinishedAt)
+		}
+		if e.Success == (e.Error != "") {
+			t.Errorf("%v: expected error to be set only for failed migrations but got %q", i, e.Error)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrIrreversible = errors.New("migrator: migration is irreversible")
+
+// IrreversibleError is returned by Migrate and Plan when the target requires downgrading past a
+// migration that can not be reversed, before any migrations are run. IrreversibleError matches
+// ErrIrreversible using errors.Is.
+type IrreversibleError struct {
+	// Version is the version of the irreversible migration.
+	Version int
+}
+
+func (e *IrreversibleError) Error() string {
+	return fmt.Sprintf("migrator: can not migrate down past version %v, the migration is irreversible", e.Version)
+}
+
+func (e *IrreversibleError) Unwrap() error {
+	return ErrIrreversible
+}
+
+// Reversible returns true if the migration can be migrated down, that is if it is not marked as
+// irreversible and has a down statement or a down Go function.
+func (m Migration) Reversible() bool {
+	return !m.Irreversible && m.hasDown()
+}
+
+// checkReversible returns an *IrreversibleError for the first of the migrations tms that can not
+// be migrated in direction dir.
+func checkReversible(tms []Migration, dir direction) error {
+	if dir != directionDown {
+		return nil
+	}
+	for _, tm := range tms {
+		if !tm.Reversible() {
+			return &IrreversibleError{Version: tm.version}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package migrator
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSQLiteIrreversible(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "drop a", Up: "DROP TABLE a", Irreversible: true},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)"},
+		{Comment: "c", Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithLatest())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+
+	cases := []struct {
+		Target  int
+		Version int
+	}{
+		{Target: 2, Version: 3}, // b has no down statement
+		{Target: 1, Version: 3},
+		{Target: 0, Version: 3},
+	}
+	for _, tc := range cases {
+		m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(tc.Target), WithAllowDown())
+		if err != nil {
+			t.Fatalf("error while creating migrator: %s", err)
+		}
+		var irreversibleErr *IrreversibleError
+		if _, err := m.Plan(); !errors.As(err, &irreversibleErr) || irreversibleErr.Version != tc.Version {
+			t.Errorf("%v: expected irreversible version %v from Plan but got %v", tc.Target, tc.Version, err)
+		}
+		ran, err := m.Migrate()
+		if !errors.Is(err, ErrIrreversible) {
+			t.Errorf("%v: expected %v but got %v", tc.Target, ErrIrreversible, err)
+		}
+		if len(ran) != 0 {
+			t.Errorf("%v: expected no migrations to run but got %v", tc.Target, len(ran))
+		}
+	}
+	if v, _ := m.Version(); v != 4 {
+		t.Errorf("expected version to still be 4 but got %v", v)
+	}
+
+	// migrating down to the irreversible migration is allowed
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(3), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+}
+
+func TestValidateIrreversible(t *testing.T) {
+	ms := Migrations{Migrations: []Migration{{Up: "a", Down: "b", Irreversible: true}}}
+	ms.enumerateMigrations()
+	if err := ms.validate(os.ReadFile); err == nil {
+		t.Errorf("expected an error for an irreversible migration with a down statement")
+	}
+}
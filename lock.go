@@ -0,0 +1,58 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+const (
+	defaultLockTimeout = time.Minute
+	lockRetryInterval  = 100 * time.Millisecond
+)
+
+var ErrLockTimeout = errors.New("migrator: timed out waiting for migration lock, is another process running migrations?")
+
+// acquireLock calls try until it acquires the lock, ctx is done or timeout has passed.
+func acquireLock(ctx context.Context, timeout time.Duration, try func(ctx context.Context) (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := try(ctx)
+		if err != nil {
+			return withContextErr(ctx, err)
+		}
+		if locked {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("migrator: cancelled while waiting for migration lock: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// withLock runs fn while holding the migration lock.
+func (b base) withLock(ctx context.Context, fn func() error) error {
+	unlock, err := b.lock(ctx, b.lockTimeout)
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if uerr := unlock(); uerr != nil {
+		return errors.Join(err, uerr)
+	}
+	return err
+}
+
+// lockKey returns the key used for PostgreSQL advisory locks for the given schema.
+func lockKey(schema string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("migrator:" + schema))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,144 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteLock(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}}}
+	mi, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithLockTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	m := mi.(SqliteMigrator)
+
+	// simulate another process holding the lock
+	unlock, err := m.lock(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("error while acquiring lock: %s", err)
+	}
+	if _, err := m.Migrate(); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected %v but got %v", ErrLockTimeout, err)
+	}
+	if err := m.Repair(); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected %v but got %v", ErrLockTimeout, err)
+	}
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version to be 0 while locked but was %v", v)
+	}
+
+	// cancelling while waiting for the lock
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.MigrateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v but got %v", context.Canceled, err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("error while releasing lock: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 1 {
+		t.Errorf("expected version to be 1 but was %v", v)
+	}
+
+	// the lock must be released after migrating
+	unlock, err = m.lock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("expected lock to be released after Migrate but got: %s", err)
+	}
+	unlock()
+}
+
+func TestSQLiteUnlock(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}}}
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1)); err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	// simulate a process that crashed while holding the lock
+	if _, err := db.Exec("INSERT INTO _migrator_lock_ (id, locked_at) VALUES (1, 'crashed')"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithLockTimeout(0))
+	if err != nil {
+		t.Fatalf("expected migrator to be created with a stale lock but got: %s", err)
+	}
+	if err := m.Force(1); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected %v but got %v", ErrLockTimeout, err)
+	}
+	if err := m.Unlock(); err != nil {
+		t.Fatalf("error while running Unlock: %s", err)
+	}
+	if err := m.Force(1); err != nil {
+		t.Fatalf("error while running Force after Unlock: %s", err)
+	}
+}
+
+func TestSQLiteConcurrentInit(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	newConcurrently(t, dsn)
+}
+
+func TestSQLiteConcurrentUpgrade(t *testing.T) {
+	// the race is not lost every time, repeat it
+	for i := range 10 {
+		dsn := filepath.Join(t.TempDir(), fmt.Sprintf("test%v.db", i))
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// version table created by the first release, without the dirty column and other tables
+		if _, err := db.Exec("CREATE TABLE _migrator_ (version INTEGER NOT NULL) STRICT; INSERT INTO _migrator_ (version) VALUES (0)"); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+		newConcurrently(t, dsn)
+	}
+}
+
+// newConcurrently creates migrators for the database dsn from several processes at the same
+// time, failing t if any of them fails.
+func newConcurrently(t *testing.T, dsn string) {
+	os.Unsetenv(envVarAllowDown)
+	migrations := Migrations{Migrations: []Migration{{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"}}}
+	const replicas = 8
+	start := make(chan struct{})
+	errs := make(chan error)
+	for range replicas {
+		go func() {
+			// every replica has its own connections
+			db, err := sql.Open("sqlite3", dsn)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+			if err := db.Ping(); err != nil {
+				errs <- err
+				return
+			}
+			<-start
+			_, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(1))
+			errs <- err
+		}()
+	}
+	close(start)
+	for range replicas {
+		if err := <-errs; err != nil {
+			t.Errorf("error while creating migrator concurrently: %s", err)
+		}
+	}
+}
@@ -1,16 +1,49 @@
 package migrator
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Migration represents an entry defined in the migration YAML.
 type Migration struct {
+	// ID is an optional stable version number for the migration, for example a timestamp
+	// like 20240101120000. If given it is used as version instead of the position in the
+	// migrations YAML-file. Either all or no migrations must have an ID.
+	ID      int    `yaml:"id"`
 	Comment string `yaml:"comment"`
-	Up      string `yaml:"up"`
-	Down    string `yaml:"down"`
-	Err     error  `yaml:"-"`
-	version int    `yaml:"-"`
+	// Tag is an optional unique name, for example a release, that can be used as target
+	// instead of the version number.
+	Tag  string `yaml:"tag"`
+	Up   string `yaml:"up"`
+	Down string `yaml:"down"`
+	// UpFile is the path to a file with the up statement, an alternative to Up. A relative
+	// path is resolved relative to the migrations YAML-file.
+	UpFile string `yaml:"up_file"`
+	// DownFile is the path to a file with the down statement, an alternative to Down. A
+	// relative path is resolved relative to the migrations YAML-file.
+	DownFile string `yaml:"down_file"`
+	// NoTransaction runs the statements outside of a transaction, required for statements
+	// like CREATE INDEX CONCURRENTLY in PostgreSQL. The version is updated in a separate
+	// transaction after the statement has run.
+	NoTransaction bool `yaml:"no_transaction"`
+	// Go marks a migration implemented by Go functions, registered with WithFunc, instead
+	// of SQL statements. It must not have any up or down statements.
+	Go bool `yaml:"go"`
+	// Irreversible marks a migration that can not be migrated down, it must not have a down
+	// statement. Migrations without a down statement or function are irreversible even if it
+	// is not set.
+	Irreversible bool   `yaml:"irreversible"`
+	Err          error  `yaml:"-"`
+	version      int    `yaml:"-"`
+	funcs        *funcs `yaml:"-"`
+	// upFromFile and downFromFile are set when Up and Down has been read from UpFile and DownFile
+	upFromFile   bool `yaml:"-"`
+	downFromFile bool `yaml:"-"`
 }
 
 // Version return the version number given for this migration. A migration gets
-// it version from its position in the migrations YAML-file.
+// it version from its ID or, if it has no ID, its position in the migrations YAML-file.
 func (m Migration) Version() int {
 	return m.version
 }
@@ -24,3 +57,41 @@ func (m Migration) stmt(dir direction) string {
 	}
 	return ""
 }
+
+// hasDown returns true if the migration has a down statement or a down Go function.
+func (m Migration) hasDown() bool {
+	return strings.TrimSpace(m.Down) != "" || m.fn(directionDown) != nil
+}
+
+// MigrationError is returned when running a migration fails. Use errors.As to inspect it.
+type MigrationError struct {
+	// Migration is the failing migration with Err set.
+	Migration Migration
+	Version   int
+	// Direction is either up or down.
+	Direction string
+	Comment   string
+	// Statement is the statement that failed.
+	Statement string
+	// Err is the error returned by the database driver.
+	Err error
+}
+
+func newMigrationError(m Migration, dir direction) *MigrationError {
+	return &MigrationError{
+		Migration: m,
+		Version:   m.Version(),
+		Direction: dir.String(),
+		Comment:   m.Comment,
+		Statement: m.stmt(dir),
+		Err:       m.Err,
+	}
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migrator: migrating %s version %v failed: %s", e.Direction, e.Version, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
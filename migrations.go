@@ -2,7 +2,12 @@ package migrator
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -13,33 +18,210 @@ type Migrations struct {
 	Migrations []Migration `yaml:"migrations"`
 }
 
-func (ms Migrations) validate() error {
-	for _, m := range ms.Migrations {
-		if strings.TrimSpace(m.Up) == "" {
+// readFunc reads files referenced by up_file and down_file.
+type readFunc func(name string) ([]byte, error)
+
+// validate validates the migrations and reads the statements of migrations referencing files
+// into Up and Down.
+func (ms Migrations) validate(read readFunc) error {
+	if err := ms.validateIDs(); err != nil {
+		return err
+	}
+	if err := ms.validateTags(); err != nil {
+		return err
+	}
+	for i, m := range ms.Migrations {
+		if m.Go {
+			if m.Up != "" || m.UpFile != "" || m.Down != "" || m.DownFile != "" {
+				return fmt.Errorf("migrator: version %v is a Go migration and can not have any up or down statements", m.Version())
+			}
+			if m.NoTransaction {
+				return fmt.Errorf("migrator: version %v is a Go migration and must run in a transaction", m.Version())
+			}
+			continue
+		}
+		if m.Up != "" && m.UpFile != "" && !m.upFromFile {
+			return fmt.Errorf("migrator: version %v has both \"up\" and \"up_file\", only one of them is allowed", m.Version())
+		}
+		if m.Down != "" && m.DownFile != "" && !m.downFromFile {
+			return fmt.Errorf("migrator: version %v has both \"down\" and \"down_file\", only one of them is allowed", m.Version())
+		}
+		if m.UpFile != "" && !m.upFromFile {
+			b, err := read(m.UpFile)
+			if err != nil {
+				return fmt.Errorf("migrator: could not read \"up_file\" for version %v: %w", m.Version(), err)
+			}
+			ms.Migrations[i].Up = string(b)
+			ms.Migrations[i].upFromFile = true
+		}
+		if m.DownFile != "" && !m.downFromFile {
+			b, err := read(m.DownFile)
+			if err != nil {
+				return fmt.Errorf("migrator: could not read \"down_file\" for version %v: %w", m.Version(), err)
+			}
+			ms.Migrations[i].Down = string(b)
+			ms.Migrations[i].downFromFile = true
+		}
+		if strings.TrimSpace(ms.Migrations[i].Up) == "" {
 			return fmt.Errorf("migrator: \"up\"-statment for version %v is either missing or empty", m.Version())
 		}
+		if m.Irreversible && strings.TrimSpace(ms.Migrations[i].Down) != "" {
+			return fmt.Errorf("migrator: version %v is irreversible and can not have a down statement", m.Version())
+		}
 	}
 	return nil
 }
 
+func (ms Migrations) validateIDs() error {
+	withID := 0
+	for i, m := range ms.Migrations {
+		if m.ID == 0 {
+			continue
+		}
+		withID++
+		if m.ID < 0 {
+			return fmt.Errorf("migrator: \"id\" %v at position %v must be greater than 0", m.ID, i+1)
+		}
+		if i > 0 && m.ID <= ms.Migrations[i-1].ID {
+			return fmt.Errorf("migrator: \"id\" %v at position %v must be greater than the previous \"id\" %v", m.ID, i+1, ms.Migrations[i-1].ID)
+		}
+	}
+	if withID > 0 && withID != len(ms.Migrations) {
+		return fmt.Errorf("migrator: either all or no migrations must have an \"id\", %v of %v migrations have one", withID, len(ms.Migrations))
+	}
+	return nil
+}
+
+func (ms Migrations) validateTags() error {
+	tags := map[string]int{}
+	for _, m := range ms.Migrations {
+		if m.Tag == "" {
+			continue
+		}
+		if reservedTag(m.Tag) {
+			return fmt.Errorf("migrator: \"tag\" %q of version %v can not be a number, start with + or - or be %s or %s", m.Tag, m.Version(), targetLatest, targetHead)
+		}
+		if v, found := tags[m.Tag]; found {
+			return fmt.Errorf("migrator: \"tag\" %q is used by both version %v and %v", m.Tag, v, m.Version())
+		}
+		tags[m.Tag] = m.Version()
+	}
+	return nil
+}
+
+// reservedTag returns true if tag could be mistaken for a target version.
+func reservedTag(tag string) bool {
+	if _, err := strconv.Atoi(tag); err == nil {
+		return true
+	}
+	return tag == targetLatest || tag == targetHead || strings.HasPrefix(tag, "+") || strings.HasPrefix(tag, "-")
+}
+
 func (ms Migrations) enumerateMigrations() {
 	for i := range ms.Migrations {
 		ms.Migrations[i].version = i + 1
+		if ms.Migrations[i].ID != 0 {
+			ms.Migrations[i].version = ms.Migrations[i].ID
+		}
 	}
 }
 
-func load() (Migrations, error) {
-	filename, found := os.LookupEnv(envVarFile)
-	if !found {
-		return Migrations{}, ErrMigrationFileEnvMissing
+// position returns the number of migrations up to and including version. Version 0, when no
+// migrations has run, is at position 0. The second return value is false if no migration has
+// the given version.
+func (ms Migrations) position(version int) (int, bool) {
+	if version == targetStart {
+		return 0, true
 	}
+	for i, m := range ms.Migrations {
+		if m.version == version {
+			return i + 1, true
+		}
+	}
+	return -1, false
+}
+
+// tagged returns the version of the migration tagged with tag.
+func (ms Migrations) tagged(tag string) (int, bool) {
+	for _, m := range ms.Migrations {
+		if m.Tag != "" && m.Tag == tag {
+			return m.version, true
+		}
+	}
+	return invalidTarget, false
+}
+
+// latest returns the version of the last migration or 0 if there are no migrations.
+func (ms Migrations) latest() int {
+	if len(ms.Migrations) == 0 {
+		return targetStart
+	}
+	return ms.Migrations[len(ms.Migrations)-1].version
+}
+
+// previous returns the version before the given version.
+func (ms Migrations) previous(version int) int {
+	if pos, _ := ms.position(version); pos > 1 {
+		return ms.Migrations[pos-2].version
+	}
+	return targetStart
+}
+
+// ReadMigrations reads migrations in YAML format from r and validates them. Relative paths
+// in up_file and down_file are resolved relative to the current working directory.
+func ReadMigrations(r io.Reader) (Migrations, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return Migrations{}, err
+	}
+	return parse(b, os.ReadFile)
+}
+
+// LoadMigrations reads migrations from the YAML file filename and validates them. Relative
+// paths in up_file and down_file are resolved relative to the directory of filename.
+func LoadMigrations(filename string) (Migrations, error) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
 		return Migrations{}, err
 	}
+	dir := filepath.Dir(filename)
+	return parse(b, func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return os.ReadFile(name)
+	})
+}
+
+// LoadMigrationsFS reads migrations from the YAML file name in fsys and validates them.
+// Use it with embed.FS to ship migrations inside your binary. Paths in up_file and
+// down_file are resolved relative to the directory of name in fsys.
+func LoadMigrationsFS(fsys fs.FS, name string) (Migrations, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return Migrations{}, err
+	}
+	dir := path.Dir(name)
+	return parse(b, func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Join(dir, name))
+	})
+}
+
+// load reads the migrations from the file given by the environment variable FILE
+// prefixed with prefix, i.e. MIGRATOR_FILE when using the default prefix.
+func load(prefix string) (Migrations, error) {
+	filename, found := os.LookupEnv(prefix + envSuffixFile)
+	if !found {
+		return Migrations{}, ErrMigrationFileEnvMissing
+	}
+	return LoadMigrations(filename)
+}
+
+func parse(b []byte, read readFunc) (Migrations, error) {
 	migrations := Migrations{}
 	if err := yaml.Unmarshal(b, &migrations); err != nil {
 		return Migrations{}, err
 	}
-	return migrations, migrations.validate()
+	migrations.enumerateMigrations()
+	return migrations, migrations.validate(read)
 }
@@ -4,12 +4,13 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestLoad(t *testing.T) {
 	os.Setenv(envVarFile, "testdata/migrations.yml")
 	defer os.Unsetenv(envVarFile)
-	m, err := load()
+	m, err := load(defaultEnvPrefix)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -24,7 +25,115 @@ func TestLoad(t *testing.T) {
 	}
 
 	os.Setenv(envVarFile, "testdata/migrations-empty-up.yml")
-	if _, err = load(); err == nil {
+	if _, err = load(defaultEnvPrefix); err == nil {
 		t.Errorf("expected and error but the error was <nil>")
 	}
 }
+
+func TestLoadMigrationsFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/migrations.yml": {Data: []byte("migrations:\n  - comment: \"First\"\n    up: CREATE TABLE test (id INTEGER)\n")},
+		"db/empty-up.yml":   {Data: []byte("migrations:\n  - comment: \"First\"\n    up:\n")},
+	}
+	m, err := LoadMigrationsFS(fsys, "db/migrations.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Migrations[0].Comment != "First" {
+		t.Errorf("expected %s but got %s", "First", m.Migrations[0].Comment)
+	}
+	if m.Migrations[0].Version() != 1 {
+		t.Errorf("expected version %v but got %v", 1, m.Migrations[0].Version())
+	}
+
+	if _, err = LoadMigrationsFS(fsys, "db/empty-up.yml"); err == nil {
+		t.Errorf("expected and error but the error was <nil>")
+	}
+	if _, err = LoadMigrationsFS(fsys, "db/missing.yml"); err == nil {
+		t.Errorf("expected and error but the error was <nil>")
+	}
+
+	if _, err = LoadMigrationsFS(os.DirFS("testdata"), "migrations.yml"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigrationsFiles(t *testing.T) {
+	m, err := LoadMigrations("testdata/migrations-files.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(m.Migrations[0].Up) != "CREATE TABLE users (id INTEGER PRIMARY KEY);" {
+		t.Errorf("expected %s but got %s", "CREATE TABLE users (id INTEGER PRIMARY KEY);", m.Migrations[0].Up)
+	}
+	if strings.TrimSpace(m.Migrations[0].Down) != "DROP TABLE users;" {
+		t.Errorf("expected %s but got %s", "DROP TABLE users;", m.Migrations[0].Down)
+	}
+	// validating loaded migrations again, as done by WithMigrations, must not fail
+	if err := m.validate(os.ReadFile); err != nil {
+		t.Errorf("unexpected error occured: %s", err)
+	}
+
+	fm, err := LoadMigrationsFS(os.DirFS("testdata"), "migrations-files.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Migrations[0].Up != m.Migrations[0].Up {
+		t.Errorf("expected %s but got %s", m.Migrations[0].Up, fm.Migrations[0].Up)
+	}
+
+	fsys := fstest.MapFS{
+		"both.yml":    {Data: []byte("migrations:\n  - up: SELECT 1\n    up_file: up.sql\n")},
+		"missing.yml": {Data: []byte("migrations:\n  - up_file: missing.sql\n")},
+		"empty.yml":   {Data: []byte("migrations:\n  - up_file: empty.sql\n")},
+		"up.sql":      {Data: []byte("SELECT 1")},
+		"empty.sql":   {Data: []byte("")},
+	}
+	for _, name := range []string{"both.yml", "missing.yml", "empty.yml"} {
+		if _, err = LoadMigrationsFS(fsys, name); err == nil {
+			t.Errorf("%s: expected and error but the error was <nil>", name)
+		}
+	}
+}
+
+func TestValidateIDs(t *testing.T) {
+	cases := []struct {
+		Migrations []Migration
+		Valid      bool
+	}{
+		{Migrations: []Migration{{Up: "a"}, {Up: "b"}}, Valid: true},
+		{Migrations: []Migration{{ID: 20240101, Up: "a"}, {ID: 20240201, Up: "b"}}, Valid: true},
+		{Migrations: []Migration{{ID: 2, Up: "a"}, {ID: 1, Up: "b"}}, Valid: false},
+		{Migrations: []Migration{{ID: 1, Up: "a"}, {ID: 1, Up: "b"}}, Valid: false},
+		{Migrations: []Migration{{ID: 1, Up: "a"}, {Up: "b"}}, Valid: false},
+		{Migrations: []Migration{{ID: -1, Up: "a"}}, Valid: false},
+	}
+	for i, tc := range cases {
+		ms := Migrations{Migrations: tc.Migrations}
+		ms.enumerateMigrations()
+		if err := ms.validate(os.ReadFile); (err == nil) != tc.Valid {
+			t.Errorf("%v: expected valid to be %v but got error %v", i, tc.Valid, err)
+		}
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	cases := []struct {
+		Migrations []Migration
+		Valid      bool
+	}{
+		{Migrations: []Migration{{Up: "a", Tag: "2024.09"}, {Up: "b", Tag: "2024.10"}}, Valid: true},
+		{Migrations: []Migration{{Up: "a", Tag: "2024.09"}, {Up: "b"}}, Valid: true},
+		{Migrations: []Migration{{Up: "a", Tag: "2024.09"}, {Up: "b", Tag: "2024.09"}}, Valid: false},
+		{Migrations: []Migration{{Up: "a", Tag: "3"}}, Valid: false},
+		{Migrations: []Migration{{Up: "a", Tag: "+release"}}, Valid: false},
+		{Migrations: []Migration{{Up: "a", Tag: "latest"}}, Valid: false},
+	}
+	for i, tc := range cases {
+		ms := Migrations{Migrations: tc.Migrations}
+		ms.enumerateMigrations()
+		if err := ms.validate(os.ReadFile); (err == nil) != tc.Valid {
+			t.Errorf("%v: expected valid to be %v but got error %v", i, tc.Valid, err)
+		}
+	}
+}
@@ -35,22 +35,31 @@
 package migrator
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"os"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	envVarFile              = "MIGRATOR_FILE"
-	envVarTarget            = "MIGRATOR_TARGET_VERSION"
-	targetStart             = 0
-	invalidTarget           = -2
-	directionUp   direction = 1
-	directionDown direction = 2
-	directionNone direction = 0
+	defaultEnvPrefix             = "MIGRATOR_"
+	envSuffixFile                = "FILE"
+	envSuffixTarget              = "TARGET_VERSION"
+	envSuffixAllowDown           = "ALLOW_DOWN"
+	envVarFile                   = defaultEnvPrefix + envSuffixFile
+	envVarTarget                 = defaultEnvPrefix + envSuffixTarget
+	envVarAllowDown              = defaultEnvPrefix + envSuffixAllowDown
+	targetStart                  = 0
+	targetLatest                 = "latest"
+	targetHead                   = "head"
+	invalidTarget                = -2
+	directionUp        direction = 1
+	directionDown      direction = 2
+	directionNone      direction = 0
 )
 
 var (
@@ -58,57 +67,364 @@ var (
 	ErrTargetOutOfBounds       = errors.New("migrator: MIGRATOR_TARGET_VERSION does not match number of migrations")
 	ErrMigratorNotInitialized  = errors.New("migrator: not initialized, did you call Init?")
 	ErrMigrationFileEnvMissing = errors.New("migrator: environment variable MIGRATOR_FILE empty, can not load migrations")
+	ErrNoMigrations            = errors.New("migrator: no migrations given, use WithMigrations, WithReader, WithFS, WithDir or WithEnv")
+	ErrUnknownDialect          = errors.New("migrator: unknown dialect")
+	ErrUnknownVersion          = errors.New("migrator: database version does not match any migration, were migrations removed or reordered?")
 )
 
 type direction int
 
+func (d direction) String() string {
+	switch d {
+	case directionUp:
+		return "up"
+	case directionDown:
+		return "down"
+	}
+	return "none"
+}
+
 type Migrator interface {
-	// Version returns the current version from the database.
+	// Version returns the current version from the database. It returns a *ChecksumError
+	// if applied migrations has been changed since they were run and ErrMigratorNotInitialized
+	// for a dry run on a database that has not been initialized.
 	Version() (int, error)
-	// Migrate will run the forward migrations in the array.
+	// VersionContext is like Version but uses ctx for all database calls.
+	VersionContext(ctx context.Context) (int, error)
+	// Migrate will run the forward migrations in the array. If a migration fails it
+	// returns the migrations that were run before it and a *MigrationError.
 	Migrate() ([]Migration, error)
+	// MigrateContext is like Migrate but uses ctx for all database calls.
+	MigrateContext(ctx context.Context) ([]Migration, error)
 	// Migrate will run the forward migrations in the array and
 	// run the callback function when the migrations has run
 	// without any error and the database has been updated to
 	// the new version.
 	MigrateCallback(fn func(m Migration)) ([]Migration, error)
-	// init will set up the Migrator for the current database.
-	init() error
-	// initialized will check if the Migrator is setup in this database.
-	initialized() (bool, error)
-	// setVersion updates the current version in the database.
-	setVersion(version int) error
+	// MigrateCallbackContext is like MigrateCallback but uses ctx for all database calls.
+	MigrateCallbackContext(ctx context.Context, fn func(m Migration)) ([]Migration, error)
+	// Repair rewrites the checksums stored for applied migrations to match the loaded
+	// migrations. Use it after deliberately changing a migration that has already run.
+	Repair() error
+	// RepairContext is like Repair but uses ctx for all database calls.
+	RepairContext(ctx context.Context) error
+	// Force sets the version in the database without running any migrations and clears
+	// the dirty flag. Use it after manually fixing a migration that failed midway.
+	Force(version int) error
+	// ForceContext is like Force but uses ctx for all database calls.
+	ForceContext(ctx context.Context, version int) error
+	// Baseline sets the version of a database that has not been migrated without running any
+	// migrations and records the migrations up to version as baselined in the history.
+	Baseline(version int) error
+	// BaselineContext is like Baseline but uses ctx for all database calls.
+	BaselineContext(ctx context.Context, version int) error
+	// Plan returns what Migrate would do without changing the database.
+	Plan() (Plan, error)
+	// PlanContext is like Plan but uses ctx for all database calls.
+	PlanContext(ctx context.Context) (Plan, error)
+	// Status returns the state of the database and of every loaded migration. It returns
+	// ErrMigratorNotInitialized for a dry run on a database that has not been initialized.
+	Status() (Status, error)
+	// StatusContext is like Status but uses ctx for all database calls.
+	StatusContext(ctx context.Context) (Status, error)
+	// History returns all migrations that has been run, in the order they were run.
+	History() ([]HistoryEntry, error)
+	// HistoryContext is like History but uses ctx for all database calls.
+	HistoryContext(ctx context.Context) ([]HistoryEntry, error)
+	// Unlock releases a migration lock left behind by a process that crashed while holding it.
+	Unlock() error
+	// UnlockContext is like Unlock but uses ctx for all database calls.
+	UnlockContext(ctx context.Context) error
+}
+
+// New returns a Migrator for the given dialect, Sqlite, Postgres or your own Dialect, ready to
+// run migrations. Migrations and target version are given with opts, the environment is only
+// used when WithEnv or WithEnvPrefix is given. Like the dialect specific constructors it will
+// initialize the database for migrations and validate the target version.
+func New(db *sql.DB, dialect Dialect, opts ...Option) (Migrator, error) {
+	return NewContext(context.Background(), db, dialect, opts...)
+}
+
+// NewContext is like New but uses ctx when initializing the database.
+func NewContext(ctx context.Context, db *sql.DB, dialect Dialect, opts ...Option) (Migrator, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newMigrator(ctx, db, dialect, c)
+	if err != nil {
+		return nil, err
+	}
+	switch dialect.(type) {
+	case SqliteDialect:
+		return SqliteMigrator{base: b}, nil
+	case PostgresDialect:
+		return PostgresMigrator{base: b}, nil
+	}
+	return b, nil
 }
 
 type base struct {
 	db         *sql.DB
+	dialect    Dialect
+	md         Metadata
 	migrations Migrations
 	target     int
+	// relative is set when the target is given as a number of steps from the current
+	// version, target is then resolved by resolveTarget when the current version is known.
+	relative    bool
+	steps       int
+	lockTimeout time.Duration
+	dryRun      bool
+	// maxDown is the number of migrations a downgrade may revert, 0 if downgrades are not
+	// allowed and unlimitedDown if there is no limit.
+	maxDown int
+	// baselineVersion is the version a database that has not been initialized is baselined
+	// at, if set.
+	baselineVersion *int
+	// outdated is set for a dry run on metadata tables created by an earlier release, they
+	// are read as if upgraded, see readOutdated.
+	outdated bool
 }
 
-func newBase(db *sql.DB, migrations Migrations) (base, error) {
-	migrations.enumerateMigrations()
-	b := base{db: db, migrations: migrations}
-	target, err := b.parseTarget()
+func newBase(db *sql.DB, c config) (base, error) {
+	migrations, err := c.loadMigrations()
 	if err != nil {
+		return base{}, err
+	}
+	b := base{db: db, migrations: migrations, lockTimeout: defaultLockTimeout, dryRun: c.dryRun, baselineVersion: c.baseline}
+	if c.lockTimeout != nil {
+		b.lockTimeout = *c.lockTimeout
+	}
+	if b.maxDown, err = c.maxDown(); err != nil {
+		return b, err
+	}
+	if err := c.target(&b); err != nil {
 		return b, err
 	}
-	b.target = target
 	return b, nil
 }
 
-func (b base) parseTarget() (int, error) {
-	target := invalidTarget
-	tStr, found := os.LookupEnv(envVarTarget)
-	if found {
-		var err error
-		target, err = strconv.Atoi(tStr)
-		if err != nil {
-			return invalidTarget, ErrInvalidTargetVersion
+// newMigrator returns a base for dialect and initializes the database for migrations, unless
+// it is a dry run.
+func newMigrator(ctx context.Context, db *sql.DB, dialect Dialect, c config) (base, error) {
+	if dialect == nil {
+		return base{}, ErrUnknownDialect
+	}
+	b, err := newBase(db, c)
+	if err != nil {
+		return base{}, err
+	}
+	schema := c.schema
+	if schema == "" {
+		schema = dialect.DefaultSchema()
+	}
+	b.dialect = dialect
+	b.md = newMetadata(dialect, schema)
+	if b.dryRun {
+		// a dry run must not change the database, not even create or upgrade the metadata tables
+		initialized, upToDate, err := dialect.Initialized(ctx, db, b.md)
+		b.outdated = initialized && !upToDate
+		return b, err
+	}
+	if err := b.setup(ctx); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// Version returns the current version from the database. It returns a *ChecksumError if
+// applied migrations has been changed since they were run and ErrMigratorNotInitialized for a
+// dry run on a database that has not been initialized.
+func (b base) Version() (int, error) {
+	return b.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but uses ctx for all database calls.
+func (b base) VersionContext(ctx context.Context) (int, error) {
+	return b.verifiedVersion(ctx)
+}
+
+// Migrate will migrate the database to version given by the environment variable MIGRATOR_TARGET_VERSION.
+// It returns an array with Migration that were run. If a migration fails it returns the migrations
+// that were run before it and a *MigrationError.
+func (b base) Migrate() ([]Migration, error) {
+	return b.MigrateContext(context.Background())
+}
+
+// MigrateContext is like Migrate but uses ctx for all database calls. If ctx is cancelled no
+// more migrations are run and the returned error wraps ctx.Err().
+func (b base) MigrateContext(ctx context.Context) ([]Migration, error) {
+	return b.migrate(ctx)
+}
+
+// Migrate will run the forward migrations in the array and run the callback function when the
+// migrations has run without any error and the database has been updated to the new version.
+func (b base) MigrateCallback(fn func(m Migration)) ([]Migration, error) {
+	return b.MigrateCallbackContext(context.Background(), fn)
+}
+
+// MigrateCallbackContext is like MigrateCallback but uses ctx for all database calls. If ctx is
+// cancelled no more migrations are run and the returned error wraps ctx.Err().
+func (b base) MigrateCallbackContext(ctx context.Context, fn func(m Migration)) ([]Migration, error) {
+	return b.migrateCallback(ctx, fn)
+}
+
+// Repair rewrites the checksums stored for applied migrations to match the loaded migrations.
+// Use it after deliberately changing a migration that has already run.
+func (b base) Repair() error {
+	return b.RepairContext(context.Background())
+}
+
+// RepairContext is like Repair but uses ctx for all database calls.
+func (b base) RepairContext(ctx context.Context) error {
+	return b.repair(ctx)
+}
+
+// Force sets the version in the database without running any migrations and clears the dirty
+// flag. Use it after manually fixing a migration that failed midway.
+func (b base) Force(version int) error {
+	return b.ForceContext(context.Background(), version)
+}
+
+// ForceContext is like Force but uses ctx for all database calls.
+func (b base) ForceContext(ctx context.Context, version int) error {
+	return b.force(ctx, version)
+}
+
+// Baseline sets the version of a database that has not been migrated without running any
+// migrations, use it to start using migrator on an existing database whose schema already
+// matches the migrations up to version. It returns ErrAlreadyMigrated if the database is not at
+// version 0 or has history.
+func (b base) Baseline(version int) error {
+	return b.BaselineContext(context.Background(), version)
+}
+
+// BaselineContext is like Baseline but uses ctx for all database calls.
+func (b base) BaselineContext(ctx context.Context, version int) error {
+	return b.baseline(ctx, version)
+}
+
+// Plan returns what Migrate would do, the current and target version and the statements that
+// would run, without changing the database.
+func (b base) Plan() (Plan, error) {
+	return b.PlanContext(context.Background())
+}
+
+// PlanContext is like Plan but uses ctx for all database calls.
+func (b base) PlanContext(ctx context.Context) (Plan, error) {
+	return b.plan(ctx)
+}
+
+// Status returns the current version of the database and whether each loaded migration has
+// been applied, when it was applied and if it has been changed since. It also reports a dirty
+// database and versions that does not match any loaded migration. It returns
+// ErrMigratorNotInitialized for a dry run on a database that has not been initialized.
+func (b base) Status() (Status, error) {
+	return b.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but uses ctx for all database calls.
+func (b base) StatusContext(ctx context.Context) (Status, error) {
+	return b.status(ctx)
+}
+
+// History returns all migrations that has been run, in the order they were run.
+func (b base) History() ([]HistoryEntry, error) {
+	return b.HistoryContext(context.Background())
+}
+
+// HistoryContext is like History but uses ctx for all database calls.
+func (b base) HistoryContext(ctx context.Context) ([]HistoryEntry, error) {
+	stmt := fmt.Sprintf("SELECT version, direction, comment, checksum, started_at, finished_at, success, error FROM %s ORDER BY id", b.md.History)
+	rows, err := b.db.QueryContext(ctx, stmt)
+	if err != nil {
+		return []HistoryEntry{}, b.readOutdated(err)
+	}
+	defer rows.Close()
+	history := []HistoryEntry{}
+	for rows.Next() {
+		e := HistoryEntry{}
+		if err := rows.Scan(&e.Version, &e.Direction, &e.Comment, &e.Checksum, timeScanner{&e.StartedAt}, timeScanner{&e.FinishedAt}, &e.Success, &e.Error); err != nil {
+			return nil, err
 		}
+		history = append(history, e)
+	}
+	return history, rows.Err()
+}
+
+// Unlock releases a migration lock left behind by a process that crashed while holding it, for
+// SQLite the row in the table _migrator_lock_. Only use it when no other process is running
+// migrations. PostgreSQL releases the lock when the connection is closed, Unlock does nothing.
+func (b base) Unlock() error {
+	return b.UnlockContext(context.Background())
+}
+
+// UnlockContext is like Unlock but uses ctx for all database calls.
+func (b base) UnlockContext(ctx context.Context) error {
+	return b.dialect.Unlock(ctx, b.db, b.md)
+}
+
+// parseTarget parses an absolute target version, latest, or head, for the version of the last
+// migration or the tag of a migration.
+func (b base) parseTarget(tStr string) (int, error) {
+	if tStr == targetLatest || tStr == targetHead {
+		return b.migrations.latest(), nil
+	}
+	if _, found := b.migrations.tagged(tStr); found {
+		return b.tagTarget(tStr)
+	}
+	target, err := strconv.Atoi(tStr)
+	if err != nil {
+		return invalidTarget, ErrInvalidTargetVersion
+	}
+	return b.checkTarget(target)
+}
+
+// tagTarget returns the version of the migration tagged with tag.
+func (b base) tagTarget(tag string) (int, error) {
+	version, found := b.migrations.tagged(tag)
+	if !found {
+		return invalidTarget, fmt.Errorf("%w: no migration tagged %q", ErrInvalidTargetVersion, tag)
+	}
+	return version, nil
+}
+
+// parseSteps parses a target relative to the current version, like +1 or -2. The second return
+// value is false if tStr is not a relative target.
+func parseSteps(tStr string) (int, bool) {
+	if !strings.HasPrefix(tStr, "+") && !strings.HasPrefix(tStr, "-") {
+		return 0, false
+	}
+	steps, err := strconv.Atoi(tStr)
+	if err != nil {
+		return 0, false
+	}
+	return steps, true
+}
+
+// resolveTarget returns the target version, resolving relative targets from the current version.
+func (b base) resolveTarget(current int) (int, error) {
+	if !b.relative {
+		return b.target, nil
+	}
+	pos, found := b.migrations.position(current)
+	if !found {
+		return invalidTarget, fmt.Errorf("%w: %v", ErrUnknownVersion, current)
 	}
+	pos += b.steps
+	if pos < 0 || pos > len(b.migrations.Migrations) {
+		return invalidTarget, ErrTargetOutOfBounds
+	}
+	if pos == 0 {
+		return targetStart, nil
+	}
+	return b.migrations.Migrations[pos-1].version, nil
+}
+
+func (b base) checkTarget(target int) (int, error) {
 	if !b.validTarget(target) {
-		if target > len(b.migrations.Migrations) {
+		if target > b.migrations.latest() {
 			return invalidTarget, ErrTargetOutOfBounds
 		}
 		return invalidTarget, ErrInvalidTargetVersion
@@ -120,10 +436,8 @@ func (b base) validTarget(target int) bool {
 	if target == invalidTarget {
 		return false
 	}
-	if target < targetStart {
-		return false
-	}
-	return target <= len(b.migrations.Migrations)
+	_, found := b.migrations.position(target)
+	return found
 }
 
 func migrationDirection(version, target int) direction {
@@ -137,11 +451,13 @@ func migrationDirection(version, target int) direction {
 }
 
 func (b base) targetMigrations(currVer int) []Migration {
+	currPos, _ := b.migrations.position(currVer)
+	targetPos, _ := b.migrations.position(b.target)
 	switch migrationDirection(currVer, b.target) {
 	case directionUp:
-		return b.migrations.Migrations[currVer:b.target]
+		return b.migrations.Migrations[currPos:targetPos]
 	case directionDown:
-		revMigations := b.migrations.Migrations[b.target:currVer]
+		revMigations := slices.Clone(b.migrations.Migrations[targetPos:currPos])
 		slices.Reverse(revMigations)
 		return revMigations
 	default:
@@ -149,26 +465,166 @@ func (b base) targetMigrations(currVer int) []Migration {
 	}
 }
 
-func (b base) migrate(m Migrator) ([]Migration, error) {
-	return b.migrateCallback(m, func(m Migration) {})
+func (b base) migrate(ctx context.Context) ([]Migration, error) {
+	return b.migrateCallback(ctx, func(m Migration) {})
+}
+
+func (b base) migrateCallback(ctx context.Context, fn func(m Migration)) ([]Migration, error) {
+	if b.dryRun {
+		p, err := b.plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return p.Migrations(), nil
+	}
+	tms := []Migration{}
+	err := b.withLock(ctx, func() error {
+		var err error
+		tms, err = b.run(ctx, fn)
+		return err
+	})
+	return tms, err
 }
 
-func (b base) migrateCallback(m Migrator, fn func(m Migration)) ([]Migration, error) {
-	v, err := m.Version()
+// current returns the current version after verifying the database is ready to be migrated.
+func (b base) current(ctx context.Context) (int, error) {
+	v, err := b.version(ctx)
 	if err != nil {
-		return nil, err
+		return -1, err
+	}
+	if _, found := b.migrations.position(v); !found {
+		return v, fmt.Errorf("%w: %v", ErrUnknownVersion, v)
+	}
+	if err := b.checkDirty(ctx); err != nil {
+		return v, err
+	}
+	if err := b.verifyChecksums(ctx); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// run runs the migrations from the current version to the target version, the caller must
+// hold the migration lock. On failure it returns the migrations that were applied before the
+// failing one.
+func (b base) run(ctx context.Context, fn func(m Migration)) ([]Migration, error) {
+	applied := []Migration{}
+	v, err := b.current(ctx)
+	if err != nil {
+		return applied, err
+	}
+	if b.target, err = b.resolveTarget(v); err != nil {
+		return applied, err
 	}
+	dir := migrationDirection(v, b.target)
 	tms := b.targetMigrations(v)
+	if err := checkReversible(tms, dir); err != nil {
+		return applied, err
+	}
+	if err := b.checkDowngrade(v, tms, dir); err != nil {
+		return applied, err
+	}
 	for _, tm := range tms {
-		if _, err := b.db.Exec(tm.stmt(migrationDirection(v, b.target))); err != nil {
-			return nil, fmt.Errorf("migrating to version %v failed: %w", tm.Version(), err)
+		if err := ctx.Err(); err != nil {
+			return applied, fmt.Errorf("migrator: cancelled before migrating to version %v: %w", tm.Version(), err)
+		}
+		entry := HistoryEntry{
+			Version:   tm.version,
+			Direction: dir.String(),
+			Comment:   tm.Comment,
+			Checksum:  tm.Checksum(),
+			StartedAt: time.Now().UTC(),
+		}
+		var err error
+		if aerr := b.apply(ctx, tm, dir); aerr != nil {
+			tm.Err = withContextErr(ctx, aerr)
+			err = newMigrationError(tm, dir)
+		}
+		entry.FinishedAt = time.Now().UTC()
+		entry.Success = err == nil
+		if err != nil {
+			entry.Error = err.Error()
 		}
-		newVersion := tm.version
-		if migrationDirection(v, b.target) == directionDown {
-			newVersion = tm.version - 1
+		// record the history even if ctx was cancelled while migrating
+		if herr := b.addHistory(context.WithoutCancel(ctx), entry); herr != nil {
+			return applied, errors.Join(err, herr)
 		}
-		m.setVersion(newVersion)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, tm)
 		fn(tm)
 	}
-	return tms, nil
+	return applied, nil
+}
+
+// apply runs the statement of migration tm in direction dir and updates version and checksum
+// within a single transaction, if any of them fails nothing is changed. Migrations with
+// NoTransaction set marks the database as dirty, runs the statement and then updates the
+// version and clears the dirty flag in a transaction.
+func (b base) apply(ctx context.Context, tm Migration, dir direction) error {
+	if tm.NoTransaction {
+		if err := b.applyStmt(ctx, b.db, tm, dir); err != nil {
+			return err
+		}
+	}
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !tm.NoTransaction {
+		if err := b.applyStmt(ctx, tx, tm, dir); err != nil {
+			return err
+		}
+	}
+	if err := b.applyVersion(ctx, tx, tm, dir); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyStmt runs the statement, or Go function, of migration tm, marking the database as dirty
+// first if tm runs outside of a transaction.
+func (b base) applyStmt(ctx context.Context, e Execer, tm Migration, dir direction) error {
+	if tm.NoTransaction {
+		if err := b.setDirty(ctx, e, tm.version); err != nil {
+			return err
+		}
+	}
+	if fn := tm.fn(dir); fn != nil {
+		return runFunc(ctx, e, tm, fn)
+	}
+	_, err := e.ExecContext(ctx, tm.stmt(dir))
+	return err
+}
+
+// applyVersion updates version, dirty flag and checksum after migration tm has run.
+func (b base) applyVersion(ctx context.Context, e Execer, tm Migration, dir direction) error {
+	newVersion := tm.version
+	if dir == directionDown {
+		newVersion = b.migrations.previous(tm.version)
+	}
+	if err := b.setVersion(ctx, e, newVersion); err != nil {
+		return err
+	}
+	if tm.NoTransaction {
+		if err := b.setDirty(ctx, e, 0); err != nil {
+			return err
+		}
+	}
+	if dir == directionDown {
+		return b.deleteChecksum(ctx, e, tm.version)
+	}
+	return b.setChecksum(ctx, e, tm.version, tm.Checksum())
+}
+
+// withContextErr wraps err with the error of ctx if ctx has been cancelled, making sure
+// errors.Is(err, context.Canceled) holds regardless of how the driver reports cancellation.
+func withContextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
 }
@@ -1,7 +1,7 @@
 package migrator
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"slices"
 	"testing"
@@ -10,7 +10,7 @@ import (
 func TestTargetVersion(t *testing.T) {
 	b := base{db: nil, migrations: Migrations{[]Migration{{}}}}
 	// no target given should result in error
-	_, err := b.parseTarget()
+	_, err := b.parseTarget(os.Getenv(envVarTarget))
 	if err == nil {
 		t.Errorf("error was nil, expected an error")
 	}
@@ -19,7 +19,7 @@ func TestTargetVersion(t *testing.T) {
 	}
 
 	os.Setenv(envVarTarget, "a")
-	_, err = b.parseTarget()
+	_, err = b.parseTarget(os.Getenv(envVarTarget))
 	if err == nil {
 		t.Errorf("error was nil, expected an error")
 	}
@@ -28,7 +28,7 @@ func TestTargetVersion(t *testing.T) {
 	}
 
 	os.Setenv(envVarTarget, "-1")
-	_, err = b.parseTarget()
+	_, err = b.parseTarget(os.Getenv(envVarTarget))
 	if err == nil {
 		t.Errorf("error was nil, expected an error")
 	}
@@ -37,7 +37,7 @@ func TestTargetVersion(t *testing.T) {
 	}
 
 	os.Setenv(envVarTarget, "5")
-	_, err = b.parseTarget()
+	_, err = b.parseTarget(os.Getenv(envVarTarget))
 	if err == nil {
 		t.Errorf("error was nil, expected an error")
 	}
@@ -46,7 +46,7 @@ func TestTargetVersion(t *testing.T) {
 	}
 
 	os.Setenv(envVarTarget, "0")
-	_, err = b.parseTarget()
+	_, err = b.parseTarget(os.Getenv(envVarTarget))
 	if err != nil {
 		t.Errorf("undexpected error occured: %s", err)
 	}
@@ -60,17 +60,17 @@ func TestValidTarget(t *testing.T) {
 
 	cases := []Case{
 		{
-			base:     base{migrations: Migrations{Migrations: []Migration{{}, {}}}},
+			base:     base{migrations: Migrations{Migrations: []Migration{{version: 1}, {version: 2}}}},
 			Target:   2,
 			Expected: true,
 		},
 		{
-			base:     base{migrations: Migrations{Migrations: []Migration{{}, {}}}},
+			base:     base{migrations: Migrations{Migrations: []Migration{{version: 1}, {version: 2}}}},
 			Target:   targetStart,
 			Expected: true, // TargetStart is the starting point when no target has been run
 		},
 		{
-			base:     base{migrations: Migrations{Migrations: []Migration{{}, {}}}},
+			base:     base{migrations: Migrations{Migrations: []Migration{{version: 1}, {version: 2}}}},
 			Target:   -1,
 			Expected: false,
 		},
@@ -128,11 +128,26 @@ func TestTargetMigrations(t *testing.T) {
 			Target:         3,
 			Expected:       []Migration{},
 		},
+		{
+			Migrations:     Migrations{Migrations: []Migration{{ID: 10, Up: "a"}, {ID: 20, Up: "b"}, {ID: 30, Up: "c"}}},
+			CurrentVersion: 10,
+			Target:         30,
+			Expected:       []Migration{{ID: 20, Up: "b", version: 20}, {ID: 30, Up: "c", version: 30}},
+		},
+		{
+			Migrations:     Migrations{Migrations: []Migration{{ID: 10, Up: "a"}, {ID: 20, Up: "b"}, {ID: 30, Up: "c"}}},
+			CurrentVersion: 30,
+			Target:         targetStart,
+			Expected:       []Migration{{ID: 30, Up: "c", version: 30}, {ID: 20, Up: "b", version: 20}, {ID: 10, Up: "a", version: 10}},
+		},
 	}
 
 	for i, tc := range cases {
-		os.Setenv(envVarTarget, fmt.Sprintf("%v", tc.Target))
-		b, err := newBase(nil, tc.Migrations)
+		c, err := newConfig(WithMigrations(tc.Migrations), WithTarget(tc.Target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := newBase(nil, c)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -142,3 +157,60 @@ func TestTargetMigrations(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSteps(t *testing.T) {
+	cases := []struct {
+		Target   string
+		Steps    int
+		Relative bool
+	}{
+		{Target: "+1", Steps: 1, Relative: true},
+		{Target: "-2", Steps: -2, Relative: true},
+		{Target: "2", Relative: false},
+		{Target: "latest", Relative: false},
+		{Target: "+a", Relative: false},
+	}
+	for i, tc := range cases {
+		steps, relative := parseSteps(tc.Target)
+		if steps != tc.Steps || relative != tc.Relative {
+			t.Errorf("%v: expected %v, %v but got %v, %v", i, tc.Steps, tc.Relative, steps, relative)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	migrations := Migrations{Migrations: []Migration{{ID: 10}, {ID: 20}, {ID: 30}}}
+	migrations.enumerateMigrations()
+	cases := []struct {
+		Steps    int
+		Current  int
+		Expected int
+		Err      error
+	}{
+		{Steps: 1, Current: targetStart, Expected: 10},
+		{Steps: 2, Current: 10, Expected: 30},
+		{Steps: -1, Current: 30, Expected: 20},
+		{Steps: -3, Current: 30, Expected: targetStart},
+		{Steps: 0, Current: 20, Expected: 20},
+		{Steps: 1, Current: 30, Err: ErrTargetOutOfBounds},
+		{Steps: -2, Current: 10, Err: ErrTargetOutOfBounds},
+		{Steps: 1, Current: 15, Err: ErrUnknownVersion},
+	}
+	for i, tc := range cases {
+		b := base{migrations: migrations, relative: true, steps: tc.Steps}
+		actual, err := b.resolveTarget(tc.Current)
+		if !errors.Is(err, tc.Err) {
+			t.Errorf("%v: expected error %v but got %v", i, tc.Err, err)
+		}
+		if err == nil && actual != tc.Expected {
+			t.Errorf("%v: expected %v but got %v", i, tc.Expected, actual)
+		}
+	}
+
+	b := base{migrations: migrations}
+	for _, latest := range []string{"latest", "head"} {
+		if target, err := b.parseTarget(latest); err != nil || target != 30 {
+			t.Errorf("%s: expected %v but got %v, %v", latest, 30, target, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package migratortest verifies that migrations can be reversed. Use it in your tests to catch
+// down statements that does not restore the schema their up statement changed:
+//
+//	func TestMigrations(t *testing.T) {
+//		migrations, err := migrator.LoadMigrations("migrations.yml")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		migratortest.RoundTrip(t, func(t testing.TB) *sql.DB {
+//			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return db
+//		}, migrator.Sqlite, migrations)
+//	}
+package migratortest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spagettikod/migrator"
+)
+
+// Factory returns a new and empty database for the test t.
+type Factory func(t testing.TB) *sql.DB
+
+// Snapshot is the schema of a database, one line per table, column, index, trigger or
+// view, sorted.
+type Snapshot []string
+
+// Diff returns the lines of s missing in other prefixed with - and the lines of other not in s
+// prefixed with +, it is empty if the snapshots are equal.
+func (s Snapshot) Diff(other Snapshot) string {
+	sb := strings.Builder{}
+	for _, l := range s {
+		if !slices.Contains(other, l) {
+			fmt.Fprintf(&sb, "- %s\n", l)
+		}
+	}
+	for _, l := range other {
+		if !slices.Contains(s, l) {
+			fmt.Fprintf(&sb, "+ %s\n", l)
+		}
+	}
+	return sb.String()
+}
+
+// RoundTrip migrates a database from factory up one version at a time to the last migration,
+// then down one version at a time to version 0, or to the last irreversible migration, and then
+// up again. The schema is snapshotted at each version and the test fails with a diff if a down
+// migration does not restore the schema of the previous version, or if migrating up again does
+// not give the same schema as the first time. opts are passed to migrator.New for every step,
+// the target is set by RoundTrip.
+func RoundTrip(t testing.TB, factory Factory, dialect migrator.Dialect, migrations migrator.Migrations, opts ...migrator.Option) {
+	t.Helper()
+	db := factory(t)
+	defer db.Close()
+	if err := roundTrip(db, dialect, migrations, opts...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func roundTrip(db *sql.DB, dialect migrator.Dialect, migrations migrator.Migrations, opts ...migrator.Option) error {
+	snapshots := map[int]Snapshot{}
+	s, err := TakeSnapshot(db, dialect)
+	if err != nil {
+		return err
+	}
+	snapshots[0] = s
+	planned, err := plan(db, dialect, migrations, opts...)
+	if err != nil {
+		return err
+	}
+	versions := []int{0}
+	for _, m := range planned {
+		versions = append(versions, m.Version())
+	}
+
+	// up
+	for _, v := range versions[1:] {
+		if err := migrate(db, dialect, migrations, v, opts...); err != nil {
+			return err
+		}
+		if snapshots[v], err = TakeSnapshot(db, dialect); err != nil {
+			return err
+		}
+	}
+	// down, stopping at the last irreversible migration
+	errs := []error{}
+	floor := 0
+	for i := len(versions) - 1; i > 0; i-- {
+		if !planned[i-1].Reversible() {
+			floor = i
+			break
+		}
+		from, to := versions[i], versions[i-1]
+		if err := migrate(db, dialect, migrations, to, opts...); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		s, err := TakeSnapshot(db, dialect)
+		if err != nil {
+			return err
+		}
+		if diff := snapshots[to].Diff(s); diff != "" {
+			errs = append(errs, fmt.Errorf("migratortest: migrating down from version %v to %v did not restore the schema of version %v:\n%s", from, to, to, diff))
+		}
+	}
+	// up again
+	for i := floor + 1; i < len(versions); i++ {
+		from, to := versions[i-1], versions[i]
+		// a broken down migration often makes the up migration fail, report both
+		if err := migrate(db, dialect, migrations, to, opts...); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		s, err := TakeSnapshot(db, dialect)
+		if err != nil {
+			return err
+		}
+		if diff := snapshots[to].Diff(s); diff != "" {
+			errs = append(errs, fmt.Errorf("migratortest: migrating up again from version %v to %v did not give the same schema as the first time:\n%s", from, to, diff))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// plan returns all migrations, with their versions, as planned when migrating db up to the last
+// migration.
+func plan(db *sql.DB, dialect migrator.Dialect, migrations migrator.Migrations, opts ...migrator.Option) ([]migrator.Migration, error) {
+	opts = append(slices.Clone(opts), migrator.WithMigrations(migrations), migrator.WithLatest())
+	m, err := migrator.New(db, dialect, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("migratortest: could not create migrator: %w", err)
+	}
+	p, err := m.Plan()
+	if err != nil {
+		return nil, fmt.Errorf("migratortest: could not plan migrations: %w", err)
+	}
+	if p.Version != 0 {
+		return nil, fmt.Errorf("migratortest: expected an empty database but it is at version %v", p.Version)
+	}
+	return p.Migrations(), nil
+}
+
+func migrate(db *sql.DB, dialect migrator.Dialect, migrations migrator.Migrations, target int, opts ...migrator.Option) error {
+	opts = append(slices.Clone(opts), migrator.WithMigrations(migrations), migrator.WithTarget(target), migrator.WithAllowDown())
+	m, err := migrator.New(db, dialect, opts...)
+	if err != nil {
+		return fmt.Errorf("migratortest: could not create migrator for version %v: %w", target, err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		return fmt.Errorf("migratortest: could not migrate to version %v: %w", target, err)
+	}
+	return nil
+}
+
+// TakeSnapshot returns the schema of db, excluding the tables used by migrator. For
+// PostgreSQL the schema is read from information_schema and pg_indexes for the current
+// schema. Only the Sqlite and Postgres dialects are supported.
+func TakeSnapshot(db *sql.DB, dialect migrator.Dialect) (Snapshot, error) {
+	var query string
+	switch dialect.(type) {
+	case migrator.SqliteDialect:
+		query = "SELECT tbl_name, type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'"
+	case migrator.PostgresDialect:
+		query = `SELECT table_name, 'table ' || table_name || ': ' || table_type FROM information_schema.tables WHERE table_schema = current_schema()
+			UNION ALL
+			SELECT table_name, 'column ' || table_name || '.' || column_name || ': ' || data_type || ' nullable ' || is_nullable || ' default ' || COALESCE(column_default, '') FROM information_schema.columns WHERE table_schema = current_schema()
+			UNION ALL
+			SELECT table_name, 'constraint ' || table_name || '.' || constraint_name || ': ' || constraint_type FROM information_schema.table_constraints WHERE table_schema = current_schema() AND constraint_type IN ('PRIMARY KEY', 'UNIQUE', 'FOREIGN KEY')
+			UNION ALL
+			SELECT tablename, 'index ' || indexname || ': ' || indexdef FROM pg_indexes WHERE schemaname = current_schema()`
+	default:
+		return nil, fmt.Errorf("%w: %T", migrator.ErrUnknownDialect, dialect)
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	s := Snapshot{}
+	for rows.Next() {
+		table, line := "", ""
+		if err := rows.Scan(&table, &line); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(table, "_migrator_") {
+			continue
+		}
+		s = append(s, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(s)
+	return s, nil
+}
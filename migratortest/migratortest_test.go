@@ -0,0 +1,65 @@
+package migratortest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/spagettikod/migrator"
+)
+
+func newSQLite(t testing.TB) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("could not open database: %s", err)
+	}
+	return db
+}
+
+func TestRoundTrip(t *testing.T) {
+	migrations := migrator.Migrations{Migrations: []migrator.Migration{
+		{Up: "CREATE TABLE a (id INTEGER PRIMARY KEY)", Down: "DROP TABLE a"},
+		{Up: "ALTER TABLE a ADD COLUMN name TEXT", Down: "ALTER TABLE a DROP COLUMN name"},
+		{Up: "CREATE INDEX a_name ON a (name)", Down: "DROP INDEX a_name"},
+	}}
+	RoundTrip(t, newSQLite, migrator.Sqlite, migrations)
+}
+
+func TestRoundTripBrokenDown(t *testing.T) {
+	migrations := migrator.Migrations{Migrations: []migrator.Migration{
+		{Up: "CREATE TABLE a (id INTEGER PRIMARY KEY)", Down: "DROP TABLE a"},
+		{Up: "CREATE TABLE b (id INTEGER PRIMARY KEY); CREATE INDEX b_id ON b (id)", Down: "DROP INDEX b_id"},
+	}}
+	db := newSQLite(t)
+	defer db.Close()
+	err := roundTrip(db, migrator.Sqlite, migrations)
+	if err == nil {
+		t.Fatalf("expected an error but the error was <nil>")
+	}
+	expected := "migrating down from version 2 to 1 did not restore the schema of version 1:\n+ table b: CREATE TABLE b (id INTEGER PRIMARY KEY)\n"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error to contain %q but got %q", expected, err)
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	before := Snapshot{"table a", "table b"}
+	after := Snapshot{"table a", "table c"}
+	if diff := before.Diff(after); diff != "- table b\n+ table c\n" {
+		t.Errorf("unexpected diff %q", diff)
+	}
+	if diff := before.Diff(before); diff != "" {
+		t.Errorf("expected no diff but got %q", diff)
+	}
+}
+
+func TestRoundTripIrreversible(t *testing.T) {
+	migrations := migrator.Migrations{Migrations: []migrator.Migration{
+		{Up: "CREATE TABLE a (id INTEGER PRIMARY KEY)", Down: "DROP TABLE a"},
+		{Up: "DROP TABLE a", Irreversible: true},
+		{Up: "CREATE TABLE b (id INTEGER PRIMARY KEY)", Down: "DROP TABLE b"},
+	}}
+	RoundTrip(t, newSQLite, migrator.Sqlite, migrations)
+}
@@ -0,0 +1,306 @@
+package migrator
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Option configures a Migrator created with New.
+type Option func(*config) error
+
+type config struct {
+	migrations    *Migrations
+	reader        io.Reader
+	fsys          fs.FS
+	fsName        string
+	dirFS         fs.FS
+	dir           string
+	targetVersion *int
+	targetLatest  bool
+	targetSteps   *int
+	targetTag     *string
+	env           bool
+	envPrefix     string
+	schema        string
+	lockTimeout   *time.Duration
+	dryRun        bool
+	baseline      *int
+	maxDownSteps  *int
+	funcs         map[int]*funcs
+}
+
+// WithMigrations sets the migrations to run. It takes precedence over WithReader, WithFS,
+// WithDir and migrations loaded from the environment. Relative paths in UpFile and
+// DownFile are resolved relative to the current working directory.
+func WithMigrations(migrations Migrations) Option {
+	return func(c *config) error {
+		c.migrations = &migrations
+		return nil
+	}
+}
+
+// WithReader reads the migrations in YAML format from r. It takes precedence over WithFS,
+// WithDir and migrations loaded from the environment.
+func WithReader(r io.Reader) Option {
+	return func(c *config) error {
+		c.reader = r
+		return nil
+	}
+}
+
+// WithFS reads the migrations from the YAML file name in fsys, for example an embed.FS. It
+// takes precedence over WithDir and migrations loaded from the environment.
+func WithFS(fsys fs.FS, name string) Option {
+	return func(c *config) error {
+		c.fsys = fsys
+		c.fsName = name
+		return nil
+	}
+}
+
+// WithDir reads the migrations from SQL files in the directory dir in fsys, see
+// LoadMigrationsDir for how files must be named. It takes precedence over migrations
+// loaded from the environment.
+func WithDir(fsys fs.FS, dir string) Option {
+	return func(c *config) error {
+		c.dirFS = fsys
+		c.dir = dir
+		return nil
+	}
+}
+
+// WithTarget sets the version to migrate to. It takes precedence over the target version
+// given in the environment and replaces any target set by WithLatest, WithSteps or WithTag.
+func WithTarget(version int) Option {
+	return func(c *config) error {
+		c.resetTarget()
+		c.targetVersion = &version
+		return nil
+	}
+}
+
+// WithLatest sets the target to the version of the last migration. It takes precedence over
+// the target version given in the environment and replaces any target set by WithTarget,
+// WithSteps or WithTag.
+func WithLatest() Option {
+	return func(c *config) error {
+		c.resetTarget()
+		c.targetLatest = true
+		return nil
+	}
+}
+
+// WithSteps sets the target to a number of migrations from the current version of the
+// database, positive to upgrade and negative to downgrade. It takes precedence over the
+// target version given in the environment and replaces any target set by WithTarget,
+// WithLatest or WithTag.
+func WithSteps(steps int) Option {
+	return func(c *config) error {
+		c.resetTarget()
+		c.targetSteps = &steps
+		return nil
+	}
+}
+
+// WithTag sets the target to the version of the migration with the given tag. It takes
+// precedence over the target version given in the environment and replaces any target set
+// by WithTarget, WithLatest or WithSteps.
+func WithTag(tag string) Option {
+	return func(c *config) error {
+		c.resetTarget()
+		c.targetTag = &tag
+		return nil
+	}
+}
+
+// WithEnv enables reading the migrations file, target version and whether downgrades are
+// allowed from the environment variables MIGRATOR_FILE, MIGRATOR_TARGET_VERSION and
+// MIGRATOR_ALLOW_DOWN. Values given with other options take precedence over the environment.
+func WithEnv() Option {
+	return WithEnvPrefix(defaultEnvPrefix)
+}
+
+// WithEnvPrefix works like WithEnv but reads the environment variables FILE,
+// TARGET_VERSION and ALLOW_DOWN prefixed with prefix instead, WithEnvPrefix("APP_") reads
+// APP_FILE, APP_TARGET_VERSION and APP_ALLOW_DOWN.
+func WithEnvPrefix(prefix string) Option {
+	return func(c *config) error {
+		c.env = true
+		c.envPrefix = prefix
+		return nil
+	}
+}
+
+// WithSchema sets the schema where the migrator keeps its tables, defaults to the DefaultSchema
+// of the dialect. For PostgreSQL it defaults to public, for SQLite it is the name of an attached
+// database and defaults to the main database.
+func WithSchema(schema string) Option {
+	return func(c *config) error {
+		c.schema = schema
+		return nil
+	}
+}
+
+// WithLockTimeout sets how long to wait for the migration lock held while migrating, defaults
+// to one minute. ErrLockTimeout is returned if the lock could not be acquired in time.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(c *config) error {
+		c.lockTimeout = &timeout
+		return nil
+	}
+}
+
+// WithDryRun makes Migrate and MigrateCallback return the migrations they would run without
+// running them or changing the database, the callback function is never called. The database
+// is not initialized and WithBaseline is ignored, a database that has not been initialized is
+// planned from version 0. Use Plan to also get the statements that would run.
+func WithDryRun() Option {
+	return func(c *config) error {
+		c.dryRun = true
+		return nil
+	}
+}
+
+// WithAllowDown allows Migrate to downgrade the database. Downgrades are not allowed by default
+// to protect against a mistyped target version dropping tables, Migrate returns a
+// *DowngradeError instead. It replaces any limit set by WithMaxDownSteps.
+func WithAllowDown() Option {
+	return WithMaxDownSteps(unlimitedDown)
+}
+
+// WithMaxDownSteps allows Migrate to downgrade the database by at most steps migrations, larger
+// downgrades returns a *DowngradeError. A steps of 0 disallows downgrades.
+func WithMaxDownSteps(steps int) Option {
+	return func(c *config) error {
+		if steps < unlimitedDown {
+			return fmt.Errorf("migrator: max down steps must be 0 or greater but was %v", steps)
+		}
+		c.maxDownSteps = &steps
+		return nil
+	}
+}
+
+// WithBaseline baselines the database at version if it has never been migrated, it is at
+// version 0 and has no history, use it to start using migrator on an existing database whose
+// schema already matches the migrations up to version. It has no effect on databases that has
+// been migrated or baselined before. See Migrator.Baseline.
+func WithBaseline(version int) Option {
+	return func(c *config) error {
+		c.baseline = &version
+		return nil
+	}
+}
+
+// WithFunc registers Go functions as the up and down migration of version. The migration
+// with that version must be marked with go: true in the migrations YAML-file, or have Go set.
+// The functions run in the same transaction as the update of the version, down may be nil.
+func WithFunc(version int, up, down MigrationFunc) Option {
+	return func(c *config) error {
+		if up == nil {
+			return fmt.Errorf("migrator: up function for version %v is nil", version)
+		}
+		if c.funcs == nil {
+			c.funcs = map[int]*funcs{}
+		}
+		c.funcs[version] = &funcs{up: up, down: down}
+		return nil
+	}
+}
+
+func (c *config) resetTarget() {
+	c.targetVersion, c.targetLatest, c.targetSteps, c.targetTag = nil, false, nil, nil
+}
+
+func newConfig(opts ...Option) (config, error) {
+	c := config{}
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return config{}, err
+		}
+	}
+	return c, nil
+}
+
+func (c config) loadMigrations() (Migrations, error) {
+	migrations, err := c.readMigrations()
+	if err != nil {
+		return Migrations{}, err
+	}
+	return migrations, migrations.registerFuncs(c.funcs)
+}
+
+func (c config) readMigrations() (Migrations, error) {
+	if c.migrations != nil {
+		migrations := Migrations{Migrations: append([]Migration{}, c.migrations.Migrations...)}
+		migrations.enumerateMigrations()
+		return migrations, migrations.validate(os.ReadFile)
+	}
+	if c.reader != nil {
+		return ReadMigrations(c.reader)
+	}
+	if c.fsys != nil {
+		return LoadMigrationsFS(c.fsys, c.fsName)
+	}
+	if c.dirFS != nil {
+		return LoadMigrationsDir(c.dirFS, c.dir)
+	}
+	if c.env {
+		return load(c.envPrefix)
+	}
+	return Migrations{}, ErrNoMigrations
+}
+
+// maxDown returns the number of migrations a downgrade may revert, given by WithAllowDown,
+// WithMaxDownSteps or the environment variable ALLOW_DOWN.
+func (c config) maxDown() (int, error) {
+	if c.maxDownSteps != nil {
+		return *c.maxDownSteps, nil
+	}
+	if c.env {
+		if s, found := os.LookupEnv(c.envPrefix + envSuffixAllowDown); found {
+			allow, err := strconv.ParseBool(s)
+			if err != nil {
+				return 0, fmt.Errorf("migrator: invalid value %q of %s, expected true or false", s, c.envPrefix+envSuffixAllowDown)
+			}
+			if allow {
+				return unlimitedDown, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// target sets the target of b from the options or the environment.
+func (c config) target(b *base) error {
+	var err error
+	switch {
+	case c.targetVersion != nil:
+		b.target, err = b.checkTarget(*c.targetVersion)
+		return err
+	case c.targetLatest:
+		b.target = b.migrations.latest()
+		return nil
+	case c.targetSteps != nil:
+		b.relative, b.steps = true, *c.targetSteps
+		return nil
+	case c.targetTag != nil:
+		b.target, err = b.tagTarget(*c.targetTag)
+		return err
+	}
+	if c.env {
+		if tStr, found := os.LookupEnv(c.envPrefix + envSuffixTarget); found {
+			if steps, ok := parseSteps(tStr); ok {
+				b.relative, b.steps = true, steps
+				return nil
+			}
+			b.target, err = b.parseTarget(tStr)
+			return err
+		}
+	}
+	b.target = invalidTarget
+	return ErrInvalidTargetVersion
+}
@@ -0,0 +1,79 @@
+package migrator
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewOptions(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+
+	yml := "migrations:\n  - up: CREATE TABLE test (id INTEGER PRIMARY KEY)\n    down: DROP TABLE test\n"
+	m, err := New(db, Sqlite, WithReader(strings.NewReader(yml)), WithTarget(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := m.Migrate()
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected to have run 1 migration but ran %v", len(ran))
+	}
+
+	// target given as option takes precedence over the environment
+	os.Setenv(envVarTarget, "2")
+	defer os.Unsetenv(envVarTarget)
+	m, err = New(db, Sqlite, WithEnv(), WithReader(strings.NewReader(yml)), WithTarget(0), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err = m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version 0 but got %v", v)
+	}
+}
+
+func TestNewOptionsErrors(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+
+	if _, err := New(db, Sqlite, WithTarget(0)); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("expected %v but got %v", ErrNoMigrations, err)
+	}
+	migrations := Migrations{Migrations: []Migration{{Up: "SELECT 1"}}}
+	if _, err := New(db, Sqlite, WithMigrations(migrations)); !errors.Is(err, ErrInvalidTargetVersion) {
+		t.Errorf("expected %v but got %v", ErrInvalidTargetVersion, err)
+	}
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2)); !errors.Is(err, ErrTargetOutOfBounds) {
+		t.Errorf("expected %v but got %v", ErrTargetOutOfBounds, err)
+	}
+	if _, err := New(db, nil, WithMigrations(migrations), WithTarget(1)); !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("expected %v but got %v", ErrUnknownDialect, err)
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+
+	os.Setenv("APP_FILE", "testdata/migrations.yml")
+	os.Setenv("APP_TARGET_VERSION", "1")
+	defer os.Unsetenv("APP_FILE")
+	defer os.Unsetenv("APP_TARGET_VERSION")
+	m, err := New(db, Sqlite, WithEnvPrefix("APP_"))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := m.Version(); v != 1 {
+		t.Errorf("expected version 1 but got %v", v)
+	}
+}
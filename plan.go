@@ -0,0 +1,136 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Plan describes what Migrate would do.
+type Plan struct {
+	// Version is the current version of the database.
+	Version int
+	// Target is the version to migrate to.
+	Target int
+	// Direction is either up, down or none if the database already is at the target version.
+	Direction string
+	Steps     []PlanStep
+}
+
+// PlanStep is a migration that would run and all statements, including updates of the
+// version tables, that would be executed for it.
+type PlanStep struct {
+	Migration  Migration
+	Statements []string
+}
+
+// Migrations returns the migrations that would run.
+func (p Plan) Migrations() []Migration {
+	ms := make([]Migration, len(p.Steps))
+	for i, s := range p.Steps {
+		ms[i] = s.Migration
+	}
+	return ms
+}
+
+// String returns the plan as an SQL script with a comment before each migration.
+func (p Plan) String() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "-- migrating %s from version %v to %v\n", p.Direction, p.Version, p.Target)
+	for _, s := range p.Steps {
+		fmt.Fprintf(&sb, "\n-- version %v", s.Migration.Version())
+		if s.Migration.Comment != "" {
+			fmt.Fprintf(&sb, ": %s", s.Migration.Comment)
+		}
+		if s.Migration.Tag != "" {
+			fmt.Fprintf(&sb, " (tag %s)", s.Migration.Tag)
+		}
+		if s.Migration.NoTransaction {
+			sb.WriteString(" (no transaction)")
+		}
+		if p.Direction == directionUp.String() && !s.Migration.Reversible() {
+			sb.WriteString(" (irreversible)")
+		}
+		sb.WriteString("\n")
+		for _, stmt := range s.Statements {
+			if strings.HasPrefix(stmt, "--") {
+				fmt.Fprintf(&sb, "%s\n", stmt)
+				continue
+			}
+			fmt.Fprintf(&sb, "%s;\n", strings.TrimRight(strings.TrimSpace(stmt), ";"))
+		}
+	}
+	return sb.String()
+}
+
+// plan returns the plan for migrating from the current version to the target version. A
+// database that has not been initialized is planned from version 0.
+func (b base) plan(ctx context.Context) (Plan, error) {
+	initialized, err := b.initialized(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+	// a dry run does not initialize the database, plan it from version 0
+	v := targetStart
+	if initialized {
+		if v, err = b.current(ctx); err != nil {
+			return Plan{}, err
+		}
+	}
+	if b.target, err = b.resolveTarget(v); err != nil {
+		return Plan{}, err
+	}
+	dir := migrationDirection(v, b.target)
+	p := Plan{Version: v, Target: b.target, Direction: dir.String(), Steps: []PlanStep{}}
+	tms := b.targetMigrations(v)
+	if err := checkReversible(tms, dir); err != nil {
+		return Plan{}, err
+	}
+	if err := b.checkDowngrade(v, tms, dir); err != nil {
+		return Plan{}, err
+	}
+	for _, tm := range tms {
+		rec := &recorder{}
+		if err := b.applyStmt(ctx, rec, tm, dir); err != nil {
+			return Plan{}, err
+		}
+		if err := b.applyVersion(ctx, rec, tm, dir); err != nil {
+			return Plan{}, err
+		}
+		p.Steps = append(p.Steps, PlanStep{Migration: tm, Statements: rec.stmts})
+	}
+	return p, nil
+}
+
+// recorder is an Execer recording statements instead of executing them.
+type recorder struct {
+	stmts []string
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.stmts = append(r.stmts, bindArgs(query, args))
+	return driver.RowsAffected(0), nil
+}
+
+// bindArgs replaces numbered placeholders, $1 or ?1, in query with the literal values of args.
+func bindArgs(query string, args []any) string {
+	// replace in reverse to not replace the beginning of $10 with $1
+	for i := len(args) - 1; i >= 0; i-- {
+		literal := fmt.Sprint(args[i])
+		switch a := args[i].(type) {
+		case string:
+			literal = "'" + strings.ReplaceAll(a, "'", "''") + "'"
+		case bool:
+			literal = "FALSE"
+			if a {
+				literal = "TRUE"
+			}
+		}
+		for _, prefix := range []string{"$", "?"} {
+			query = strings.ReplaceAll(query, fmt.Sprintf("%s%v", prefix, i+1), literal)
+		}
+	}
+	return query
+}
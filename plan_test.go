@@ -0,0 +1,153 @@
+package migrator
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBindArgs(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Args     []any
+		Expected string
+	}{
+		{Query: "UPDATE t SET v = ?1", Args: []any{2}, Expected: "UPDATE t SET v = 2"},
+		{Query: "INSERT INTO t VALUES ($1, $2)", Args: []any{1, "it's"}, Expected: "INSERT INTO t VALUES (1, 'it''s')"},
+		{Query: "SELECT $1, $10", Args: []any{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, Expected: "SELECT 1, 10"},
+	}
+	for i, tc := range cases {
+		if actual := bindArgs(tc.Query, tc.Args); actual != tc.Expected {
+			t.Errorf("%v: expected %s but got %s", i, tc.Expected, actual)
+		}
+	}
+}
+
+func TestSQLitePlan(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	p, err := m.Plan()
+	if err != nil {
+		t.Fatalf("error while running Plan: %s", err)
+	}
+	if p.Version != 0 || p.Target != 2 || p.Direction != "up" {
+		t.Errorf("expected plan from 0 to 2 up but got %v to %v %s", p.Version, p.Target, p.Direction)
+	}
+	if len(p.Steps) != 2 {
+		t.Fatalf("expected 2 steps but got %v", len(p.Steps))
+	}
+	expected := []string{
+		"CREATE TABLE a (id INTEGER)",
+		"UPDATE _migrator_ SET version = 1",
+	}
+	if !slices.Equal(p.Steps[0].Statements[:2], expected) {
+		t.Errorf("expected statements %v but got %v", expected, p.Steps[0].Statements)
+	}
+	if !strings.Contains(p.String(), "-- version 2: b\nCREATE TABLE b (id INTEGER);\n") {
+		t.Errorf("unexpected plan script:\n%s", p)
+	}
+
+	// the database must not have been changed
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version to be 0 after Plan but was %v", v)
+	}
+
+	// dry run
+	m, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(2), WithDryRun())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := m.MigrateCallback(func(m Migration) { t.Errorf("callback must not be called on dry run") })
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 2 {
+		t.Errorf("expected 2 migrations but got %v", len(ran))
+	}
+	if v, _ := m.Version(); v != 0 {
+		t.Errorf("expected version to be 0 after dry run but was %v", v)
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM sqlite_master WHERE type='table' AND name='a'").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("didn't expect to find table named 'a' after dry run but did")
+	}
+}
+
+func TestSQLiteDryRunUninitialized(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(1), WithDryRun(), WithBaseline(1))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := m.Migrate()
+	if err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected 1 migration but got %v", len(ran))
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM sqlite_master").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected dry run to not create any tables but found %v", count)
+	}
+}
+
+func TestSQLiteDryRunOutdated(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	// version table created by the first release, without the dirty column and other tables
+	if _, err := db.Exec("CREATE TABLE _migrator_ (version INTEGER NOT NULL) STRICT; INSERT INTO _migrator_ (version) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2), WithDryRun())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	p, err := m.Plan()
+	if err != nil {
+		t.Fatalf("error while planning: %s", err)
+	}
+	if p.Version != 1 || len(p.Steps) != 1 || p.Steps[0].Migration.Version() != 2 {
+		t.Errorf("expected a plan from version 1 with migration 2 but got %+v", p)
+	}
+	s, err := m.Status()
+	if err != nil {
+		t.Fatalf("error while reading status: %s", err)
+	}
+	if s.Version != 1 || s.Dirty != 0 || s.Migrations[0].Checksum != ChecksumMissing {
+		t.Errorf("expected a clean database at version 1 without checksums but got %+v", s)
+	}
+	count := -1
+	if err := db.QueryRow("SELECT COUNT(1) FROM sqlite_master").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected dry run to not create or upgrade any tables but found %v tables", count)
+	}
+	if hasDirty, err := sqliteHasDirty(context.Background(), db, newMetadata(Sqlite, "")); err != nil || hasDirty {
+		t.Errorf("expected dry run to not add the dirty column: %v", err)
+	}
+}
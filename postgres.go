@@ -1,101 +1,162 @@
 package migrator
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 )
 
+const defaultPostgresSchema = "public"
+
+var ErrSingleConnection = errors.New("migrator: the PostgreSQL migration lock needs at least two open connections, do not call SetMaxOpenConns(1)")
+
+// Postgres is the Dialect for PostgreSQL databases.
+var Postgres Dialect = PostgresDialect{}
+
+// PostgresDialect runs migrations against PostgreSQL. The metadata tables are created in the
+// schema given with WithSchema, public by default.
+type PostgresDialect struct{}
+
 type PostgresMigrator struct {
 	base
-	schema string
 }
 
 // NewPostgresMigrator returns a PostgresMigrator ready to run migrations. It will initialize and
 // validate the database is ready for migrations. It also validates the given migration target is
 // valid.
 func NewPostgresMigrator(db *sql.DB, schema string) (PostgresMigrator, error) {
-	migrations, err := load()
-	if err != nil {
-		return PostgresMigrator{}, err
-	}
-	base, err := newBase(db, migrations)
+	c, err := newConfig(WithEnv(), WithSchema(schema))
 	if err != nil {
 		return PostgresMigrator{}, err
 	}
-
-	if schema == "" {
-		schema = "public"
-	}
-	sm := PostgresMigrator{base: base, schema: schema}
-	if err := sm.init(); err != nil {
-		return sm, err
-	}
-	return sm, nil
+	b, err := newMigrator(context.Background(), db, Postgres, c)
+	return PostgresMigrator{base: b}, err
 }
 
-// Version returns the current version from the database.
-func (pm PostgresMigrator) Version() (int, error) {
-	initialized, err := pm.initialized()
-	if err != nil {
-		return -1, err
-	}
-	if !initialized {
-		return 0, ErrMigratorNotInitialized
-	}
-
-	row := pm.db.QueryRow(fmt.Sprintf("SELECT version FROM %s._migrator_", pm.schema))
-	version := 0
-	if err := row.Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return -1, err
-	}
-	return version, nil
+func (PostgresDialect) DefaultSchema() string {
+	return defaultPostgresSchema
 }
 
-// Migrate will migrate the database to version given by the environment variable MIGRATOR_TARGET_VERSION.
-// If it fails it will return an error. On successful migration it will return an array with Migration
-// that were run.
-func (pm PostgresMigrator) Migrate() ([]Migration, error) {
-	return pm.migrate(pm)
+func (PostgresDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name)
 }
 
-// Migrate will run the forward migrations in the array and run the callback function when the
-// migrations has run without any error and the database has been updated to the new version.
-func (pm PostgresMigrator) MigrateCallback(fn func(m Migration)) ([]Migration, error) {
-	return pm.migrateCallback(pm, fn)
+func (PostgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
 }
 
-func (pm PostgresMigrator) init() error {
-	initialized, err := pm.initialized()
+func (d PostgresDialect) Init(ctx context.Context, db *sql.DB, md Metadata) error {
+	initialized, _, err := d.Initialized(ctx, db, md)
 	if err != nil {
 		return err
 	}
 	if !initialized {
-		_, err = pm.db.Exec(fmt.Sprintf("CREATE TABLE %s._migrator_ (version INTEGER NOT NULL)", pm.schema))
+		_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (version BIGINT NOT NULL, dirty BIGINT NOT NULL DEFAULT 0)", md.Version))
 		if err != nil {
 			return err
 		}
-		_, err = pm.db.Exec(fmt.Sprintf("INSERT INTO %s._migrator_ (version) VALUES (0)", pm.schema))
+		_, err = db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (0)", md.Version))
+		if err != nil {
+			return err
+		}
+	}
+	// dirty was added after the first release, add it to version tables created before
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS dirty BIGINT NOT NULL DEFAULT 0", md.Version))
+	if err != nil {
 		return err
 	}
-	return nil
+	// version was an INTEGER in the first release, widen it to fit timestamp IDs
+	row := db.QueryRowContext(ctx, "SELECT data_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = 'version'", md.Schema, tableVersion)
+	dataType := ""
+	if err := row.Scan(&dataType); err != nil {
+		return err
+	}
+	if dataType != "bigint" {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN version TYPE BIGINT", md.Version)); err != nil {
+			return err
+		}
+	}
+	// checksums were added after the first release, create table even if initialized
+	_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, checksum TEXT NOT NULL)", md.Checksums))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		version BIGINT NOT NULL,
+		direction TEXT NOT NULL,
+		comment TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ NOT NULL,
+		success BOOLEAN NOT NULL,
+		error TEXT NOT NULL)`, md.History))
+	return err
 }
 
-func (pm PostgresMigrator) initialized() (bool, error) {
-	row := pm.db.QueryRow("SELECT table_name FROM information_schema.tables WHERE table_schema = $1 AND table_name = '_migrator_'", pm.schema)
-	name := ""
-	err := row.Scan(&name)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
-		return false, err
+// Initialized reports the version table as up to date if it has the dirty column, the version
+// column is a BIGINT and the checksums and history tables exist.
+func (PostgresDialect) Initialized(ctx context.Context, db *sql.DB, md Metadata) (bool, bool, error) {
+	row := db.QueryRowContext(ctx, `SELECT
+		EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2),
+		EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = 'dirty'),
+		EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = 'version' AND data_type = 'bigint'),
+		EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = $3),
+		EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = $4)`,
+		md.Schema, tableVersion, tableChecksums, tableHistory)
+	initialized, hasDirty, hasBigint, hasChecksums, hasHistory := false, false, false, false, false
+	if err := row.Scan(&initialized, &hasDirty, &hasBigint, &hasChecksums, &hasHistory); err != nil {
+		return false, false, err
 	}
-	return true, nil
+	return initialized, initialized && hasDirty && hasBigint && hasChecksums && hasHistory, nil
 }
 
-func (pm PostgresMigrator) setVersion(version int) error {
-	stmt := fmt.Sprintf("UPDATE %s._migrator_ SET version = $1", pm.schema)
-	_, err := pm.db.Exec(stmt, version)
+func (PostgresDialect) Version(ctx context.Context, db *sql.DB, md Metadata) (int, error) {
+	row := db.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s", md.Version))
+	version := 0
+	if err := row.Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return -1, err
+	}
+	return version, nil
+}
+
+func (PostgresDialect) SetVersion(ctx context.Context, e Execer, md Metadata, version int) error {
+	stmt := fmt.Sprintf("UPDATE %s SET version = $1", md.Version)
+	_, err := e.ExecContext(ctx, stmt, version)
 	return err
 }
+
+// Lock acquires a session level advisory lock keyed on the schema. The lock is held by a
+// dedicated connection and released when the connection is closed, even if the process crashes.
+// Migrations run on other connections, db must allow at least two open connections.
+func (PostgresDialect) Lock(ctx context.Context, db *sql.DB, md Metadata, timeout time.Duration) (func() error, error) {
+	if db.Stats().MaxOpenConnections == 1 {
+		return nil, ErrSingleConnection
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := lockKey(md.Schema)
+	err = acquireLock(ctx, timeout, func(ctx context.Context) (bool, error) {
+		locked := false
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() error {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", key)
+		return errors.Join(err, conn.Close())
+	}, nil
+}
+
+// Unlock does nothing, advisory locks are released when the connection holding them is closed.
+func (PostgresDialect) Unlock(ctx context.Context, db *sql.DB, md Metadata) error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package migrator
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -35,6 +36,7 @@ func connect(t *testing.T, target, filename string) *sql.DB {
 func tearDownTest(db *sql.DB) {
 	os.Unsetenv(envVarFile)
 	os.Unsetenv(envVarTarget)
+	os.Unsetenv(envVarAllowDown)
 	db.Close()
 }
 
@@ -47,7 +49,7 @@ func test_PostgresInit(t *testing.T) {
 		t.Fatalf("could not create PostgresMigrator: %s", err)
 	}
 
-	ok, err := pm.initialized()
+	ok, err := pm.initialized(context.Background())
 	if err != nil {
 		t.Fatalf("error while checking if initialized: %s", err)
 	}
@@ -65,7 +67,7 @@ func test_PostgresVersion(t *testing.T) {
 		t.Fatalf("could not create PostgresMigrator: %s", err)
 	}
 	// initialize
-	if err := pm.init(); err != nil {
+	if err := pm.init(context.Background()); err != nil {
 		t.Fatalf("error while running init: %s", err)
 	}
 
@@ -79,7 +81,7 @@ func test_PostgresVersion(t *testing.T) {
 	}
 
 	// set version to 5
-	if err := pm.setVersion(5); err != nil {
+	if err := pm.setVersion(context.Background(), pm.db, 5); err != nil {
 		t.Fatalf("failed while running SetVersion: %s", err)
 	}
 
@@ -129,6 +131,7 @@ func TestPostgresMigrate(t *testing.T) {
 
 	// downgrade
 	os.Setenv(envVarTarget, "0")
+	os.Setenv(envVarAllowDown, "true")
 	pm, err = NewPostgresMigrator(db, "")
 	if err != nil {
 		t.Fatalf("could not create PostgresMigrator: %s", err)
@@ -150,4 +153,15 @@ func TestPostgresMigrate(t *testing.T) {
 	if count != 0 {
 		t.Fatalf("didn't expect to find table named 'test' but did")
 	}
+
+	history, err := pm.History()
+	if err != nil {
+		t.Fatalf("error while running History: %s", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries but got %v", len(history))
+	}
+	if history[1].Direction != "down" {
+		t.Errorf("expected last history entry to be down but was %s", history[1].Direction)
+	}
 }
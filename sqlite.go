@@ -1,10 +1,21 @@
 package migrator
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"time"
 )
 
+// Sqlite is the Dialect for SQLite databases.
+var Sqlite Dialect = SqliteDialect{}
+
+// SqliteDialect runs migrations against SQLite. A schema given with WithSchema is the name of an
+// attached database, by default the metadata tables are created in the main database.
+type SqliteDialect struct{}
+
 type SqliteMigrator struct {
 	base
 }
@@ -13,32 +24,107 @@ type SqliteMigrator struct {
 // validate the database is ready for migrations. It also validates the given migration target is
 // valid.
 func NewSqliteMigrator(db *sql.DB) (SqliteMigrator, error) {
-	migrations, err := load()
+	c, err := newConfig(WithEnv())
 	if err != nil {
 		return SqliteMigrator{}, err
 	}
-	base, err := newBase(db, migrations)
+	b, err := newMigrator(context.Background(), db, Sqlite, c)
+	return SqliteMigrator{base: b}, err
+}
+
+func (SqliteDialect) DefaultSchema() string {
+	return ""
+}
+
+func (SqliteDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name)
+}
+
+func (SqliteDialect) Placeholder(n int) string {
+	return "?" + strconv.Itoa(n)
+}
+
+func (d SqliteDialect) Init(ctx context.Context, db *sql.DB, md Metadata) error {
+	initialized, _, err := d.Initialized(ctx, db, md)
 	if err != nil {
-		return SqliteMigrator{}, err
+		return err
+	}
+	if !initialized {
+		_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (version INTEGER NOT NULL, dirty INTEGER NOT NULL DEFAULT 0) STRICT", md.Version))
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (0)", md.Version))
+		if err != nil {
+			return err
+		}
 	}
-	sm := SqliteMigrator{base: base}
-	if err := sm.init(); err != nil {
-		return sm, err
+	// dirty was added after the first release, add it to version tables created before
+	hasDirty, err := sqliteHasDirty(ctx, db, md)
+	if err != nil {
+		return err
 	}
-	return sm, nil
+	if !hasDirty {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN dirty INTEGER NOT NULL DEFAULT 0", md.Version)); err != nil {
+			return err
+		}
+	}
+	// checksums were added after the first release, create table even if initialized
+	_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY, checksum TEXT NOT NULL) STRICT", md.Checksums))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version INTEGER NOT NULL,
+		direction TEXT NOT NULL,
+		comment TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		success INTEGER NOT NULL,
+		error TEXT NOT NULL) STRICT`, md.History))
+	if err != nil {
+		return err
+	}
+	return createLockTable(ctx, db, md)
 }
 
-// Version returns the current version from the database.
-func (sm SqliteMigrator) Version() (int, error) {
-	initialized, err := sm.initialized()
+// Initialized reports the version table as up to date if it has the dirty column and the
+// checksums, history and lock tables exist.
+func (SqliteDialect) Initialized(ctx context.Context, db *sql.DB, md Metadata) (bool, bool, error) {
+	master := "sqlite_master"
+	if md.Schema != "" {
+		master = quoteIdentifier(md.Schema) + "." + master
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s WHERE type = 'table' AND name IN (?1, ?2, ?3, ?4)", master), tableVersion, tableChecksums, tableHistory, tableLock)
 	if err != nil {
-		return -1, err
+		return false, false, err
 	}
-	if !initialized {
-		return 0, ErrMigratorNotInitialized
+	defer rows.Close()
+	tables := map[string]bool{}
+	for rows.Next() {
+		name := ""
+		if err := rows.Scan(&name); err != nil {
+			return false, false, err
+		}
+		tables[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, false, err
 	}
+	if !tables[tableVersion] {
+		return false, false, nil
+	}
+	hasDirty, err := sqliteHasDirty(ctx, db, md)
+	if err != nil {
+		return true, false, err
+	}
+	return true, hasDirty && tables[tableChecksums] && tables[tableHistory] && tables[tableLock], nil
+}
 
-	row := sm.db.QueryRow("SELECT version FROM _migrator_")
+func (SqliteDialect) Version(ctx context.Context, db *sql.DB, md Metadata) (int, error) {
+	row := db.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s", md.Version))
 	version := 0
 	if err := row.Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return -1, err
@@ -46,49 +132,63 @@ func (sm SqliteMigrator) Version() (int, error) {
 	return version, nil
 }
 
-// Migrate will migrate the database to version given by the environment variable MIGRATOR_TARGET_VERSION.
-// If it fails it will return an error. On successful migration it will return an array with Migration
-// that were run.
-func (sm SqliteMigrator) Migrate() ([]Migration, error) {
-	return sm.migrate(sm)
-}
-
-// Migrate will run the forward migrations in the array and run the callback function when the
-// migrations has run without any error and the database has been updated to the new version.
-func (sm SqliteMigrator) MigrateCallback(fn func(m Migration)) ([]Migration, error) {
-	return sm.migrateCallback(sm, fn)
+func (SqliteDialect) SetVersion(ctx context.Context, e Execer, md Metadata, version int) error {
+	stmt := fmt.Sprintf("UPDATE %s SET version = ?1", md.Version)
+	_, err := e.ExecContext(ctx, stmt, version)
+	return err
 }
 
-func (sm SqliteMigrator) init() error {
-	initialized, err := sm.initialized()
-	if err != nil {
-		return err
+// Lock acquires the migration lock by inserting the single row in the lock table, creating the
+// table if it does not exist. If a process crashes while holding the lock the row is left behind,
+// remove it with Unlock.
+func (SqliteDialect) Lock(ctx context.Context, db *sql.DB, md Metadata, timeout time.Duration) (func() error, error) {
+	if err := createLockTable(ctx, db, md); err != nil {
+		return nil, err
 	}
-	if !initialized {
-		_, err = sm.db.Exec("CREATE TABLE _migrator_ (version INTEGER NOT NULL) STRICT")
+	err := acquireLock(ctx, timeout, func(ctx context.Context) (bool, error) {
+		stmt := fmt.Sprintf("INSERT INTO %s (id, locked_at) VALUES (1, ?1) ON CONFLICT DO NOTHING", md.Lock)
+		res, err := db.ExecContext(ctx, stmt, time.Now().UTC().Format(time.RFC3339Nano))
 		if err != nil {
-			return err
+			return false, err
 		}
-		_, err = sm.db.Exec("INSERT INTO _migrator_ (version) VALUES (0)")
+		n, err := res.RowsAffected()
+		return n == 1, err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return err
+	return func() error {
+		return SqliteDialect{}.Unlock(context.WithoutCancel(ctx), db, md)
+	}, nil
 }
 
-func (sm SqliteMigrator) initialized() (bool, error) {
-	row := sm.db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = '_migrator_'")
-	name := ""
-	err := row.Scan(&name)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+// Unlock removes the row in the lock table.
+func (SqliteDialect) Unlock(ctx context.Context, db *sql.DB, md Metadata) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1", md.Lock))
+	return err
 }
 
-func (sm SqliteMigrator) setVersion(version int) error {
-	stmt := "UPDATE _migrator_ SET version = ?1"
-	_, err := sm.db.Exec(stmt, version)
+func createLockTable(ctx context.Context, db *sql.DB, md Metadata) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY CHECK (id = 1), locked_at TEXT NOT NULL) STRICT", md.Lock))
 	return err
 }
+
+// textTimes marks that SQLite, lacking a timestamp type, stores times in the history table as
+// RFC 3339 text.
+func (SqliteDialect) textTimes() {}
+
+// sqliteHasDirty returns true if the version table has the dirty column.
+func sqliteHasDirty(ctx context.Context, db *sql.DB, md Metadata) (bool, error) {
+	row := db.QueryRowContext(ctx, "SELECT COUNT(1) FROM pragma_table_info(?1, ?2) WHERE name = 'dirty'", tableVersion, sqliteSchema(md))
+	hasDirty := 0
+	err := row.Scan(&hasDirty)
+	return hasDirty > 0, err
+}
+
+// sqliteSchema returns the name of the database holding the metadata tables.
+func sqliteSchema(md Metadata) string {
+	if md.Schema == "" {
+		return "main"
+	}
+	return md.Schema
+}
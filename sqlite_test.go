@@ -1,8 +1,11 @@
 package migrator
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -11,6 +14,7 @@ import (
 func initSQLiteTest(t *testing.T) *sql.DB {
 	os.Unsetenv(envVarFile)
 	os.Unsetenv(envVarTarget)
+	os.Unsetenv(envVarAllowDown)
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("could not open database: %s", err)
@@ -27,7 +31,7 @@ func TestSQLiteInitialized(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error while creating migrator: %s", err)
 	}
-	ok, err := sm.initialized()
+	ok, err := sm.initialized(context.Background())
 	if err != nil {
 		t.Fatalf("error while checking if initialized: %s", err)
 	}
@@ -56,7 +60,7 @@ func TestSQLiteVersion(t *testing.T) {
 	}
 
 	// set version to 5
-	if err := sm.setVersion(5); err != nil {
+	if err := sm.setVersion(context.Background(), sm.db, 5); err != nil {
 		t.Fatalf("failed while running SetVersion: %s", err)
 	}
 
@@ -109,6 +113,8 @@ func TestSQLiteMigrate(t *testing.T) {
 
 	// downgrade
 	os.Setenv(envVarTarget, "0")
+	os.Setenv(envVarAllowDown, "true")
+	defer os.Unsetenv(envVarAllowDown)
 	sm, err = NewSqliteMigrator(db)
 	if err != nil {
 		t.Fatalf("could not load migration yaml: %s", err)
@@ -138,3 +144,271 @@ func TestSQLiteMigrate(t *testing.T) {
 		t.Fatalf("didn't expect to find table named 'test' but did")
 	}
 }
+
+func TestSQLiteMigrateIDs(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{ID: 20240101, Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{ID: 20240201, Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(20240201))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := sm.Version(); v != 20240201 {
+		t.Fatalf("expected version %v but got %v", 20240201, v)
+	}
+
+	// downgrade to the first migration
+	sm, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(20240101), WithAllowDown())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := sm.Version(); v != 20240101 {
+		t.Fatalf("expected version %v but got %v", 20240101, v)
+	}
+
+	// removing the applied migration must be detected
+	removed := Migrations{Migrations: migrations.Migrations[1:]}
+	sm, err = New(db, Sqlite, WithMigrations(removed), WithTarget(20240201))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected %v but got %v", ErrUnknownVersion, err)
+	}
+}
+
+func TestSQLiteMigrateTransaction(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Up: "CREATE TABLE b (id INTEGER); CREATE TABLE", Down: "DROP TABLE b"},
+	}}
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); err == nil {
+		t.Fatalf("expected and error but the error was <nil>")
+	}
+	if v, _ := sm.Version(); v != 1 {
+		t.Errorf("expected version to be 1 after failed migration but was %v", v)
+	}
+
+	// the failing migration must be rolled back as a whole
+	row := db.QueryRow("SELECT COUNT(1) FROM sqlite_master WHERE type='table' AND name='b'")
+	count := -1
+	if err := row.Scan(&count); err != nil {
+		t.Fatalf("error while running verifying test: %s", err)
+	}
+	if count != 0 {
+		t.Fatalf("didn't expect to find table named 'b' but did")
+	}
+}
+
+func TestSQLiteMigrateNoTransaction(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	// VACUUM can not run within a transaction
+	migrations := Migrations{Migrations: []Migration{
+		{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Up: "VACUUM", Down: "VACUUM", NoTransaction: true},
+		{Up: "VACUUM", Down: "VACUUM"},
+	}}
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if v, _ := sm.Version(); v != 2 {
+		t.Errorf("expected version to be 2 but was %v", v)
+	}
+
+	sm, err = New(db, Sqlite, WithMigrations(migrations), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); err == nil {
+		t.Fatalf("expected and error but the error was <nil>")
+	}
+	if v, _ := sm.Version(); v != 2 {
+		t.Errorf("expected version to be 2 but was %v", v)
+	}
+}
+
+func TestSQLiteMigrateContext(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}}
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+
+	// cancel after the first migration has run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran, err := sm.MigrateCallbackContext(ctx, func(m Migration) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v but got %v", context.Canceled, err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected the migration run before cancel to be returned but got %v", ran)
+	}
+	v, err := sm.VersionContext(context.Background())
+	if err != nil {
+		t.Fatalf("error while running Version: %s", err)
+	}
+	if v != 1 {
+		t.Errorf("expected version to be 1 after cancel but was %v", v)
+	}
+
+	if _, err := sm.VersionContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if _, err := sm.MigrateContext(context.Background()); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+}
+
+func TestSQLiteMigrationError(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Comment: "broken", Up: "CREATE TABLE", Down: "DROP TABLE c"},
+	}}
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(3))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	ran, err := sm.Migrate()
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("expected a *MigrationError but got %v", err)
+	}
+	if len(ran) != 2 || ran[1].Comment != "b" {
+		t.Errorf("expected the 2 successful migrations to be returned but got %v", ran)
+	}
+	if migrationErr.Version != 3 || migrationErr.Direction != "up" || migrationErr.Comment != "broken" {
+		t.Errorf("unexpected migration error: %+v", migrationErr)
+	}
+	if migrationErr.Statement != "CREATE TABLE" {
+		t.Errorf("expected statement %s but got %s", "CREATE TABLE", migrationErr.Statement)
+	}
+	if migrationErr.Err == nil || migrationErr.Migration.Err != migrationErr.Err {
+		t.Errorf("expected Err to be set on the failing migration but got %v", migrationErr.Migration.Err)
+	}
+}
+
+func TestSQLiteMigrateRelative(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	os.Setenv(envVarFile, "testdata/migrations.yml")
+	os.Setenv(envVarAllowDown, "true")
+	defer os.Unsetenv(envVarFile)
+	defer os.Unsetenv(envVarTarget)
+	defer os.Unsetenv(envVarAllowDown)
+
+	steps := []struct {
+		Target   string
+		Expected int
+	}{
+		{Target: "+1", Expected: 1},
+		{Target: "+1", Expected: 2},
+		{Target: "-2", Expected: 0},
+		{Target: "latest", Expected: 2},
+		{Target: "-1", Expected: 1},
+		{Target: "head", Expected: 2},
+	}
+	for _, s := range steps {
+		os.Setenv(envVarTarget, s.Target)
+		sm, err := NewSqliteMigrator(db)
+		if err != nil {
+			t.Fatalf("%s: error while creating migrator: %s", s.Target, err)
+		}
+		if _, err := sm.Migrate(); err != nil {
+			t.Fatalf("%s: error while running Migrate: %s", s.Target, err)
+		}
+		if v, _ := sm.Version(); v != s.Expected {
+			t.Fatalf("%s: expected version %v but got %v", s.Target, s.Expected, v)
+		}
+	}
+
+	// relative targets beyond the migrations are out of bounds
+	os.Setenv(envVarTarget, "+1")
+	sm, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := sm.Migrate(); !errors.Is(err, ErrTargetOutOfBounds) {
+		t.Errorf("expected %v but got %v", ErrTargetOutOfBounds, err)
+	}
+}
+
+func TestSQLiteMigrateTag(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a", Tag: "2024.09"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+		{Comment: "c", Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c", Tag: "2024.10"},
+	}}
+
+	steps := []struct {
+		Option   Option
+		Expected int
+	}{
+		{Option: WithTag("2024.10"), Expected: 3},
+		{Option: WithTag("2024.09"), Expected: 1},
+	}
+	for _, s := range steps {
+		sm, err := New(db, Sqlite, WithMigrations(migrations), s.Option, WithAllowDown())
+		if err != nil {
+			t.Fatalf("error while creating migrator: %s", err)
+		}
+		if _, err := sm.Migrate(); err != nil {
+			t.Fatalf("error while running Migrate: %s", err)
+		}
+		if v, _ := sm.Version(); v != s.Expected {
+			t.Fatalf("expected version %v but got %v", s.Expected, v)
+		}
+	}
+
+	// tags can be given as target in the environment
+	os.Setenv(envVarTarget, "2024.10")
+	defer os.Unsetenv(envVarTarget)
+	sm, err := New(db, Sqlite, WithMigrations(migrations), WithEnv())
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	p, err := sm.Plan()
+	if err != nil {
+		t.Fatalf("error while running Plan: %s", err)
+	}
+	if p.Target != 3 {
+		t.Errorf("expected target 3 but got %v", p.Target)
+	}
+	if !strings.Contains(p.String(), "-- version 3: c (tag 2024.10)\n") {
+		t.Errorf("expected tag in plan script:\n%s", p)
+	}
+
+	if _, err := New(db, Sqlite, WithMigrations(migrations), WithTag("2025.01")); !errors.Is(err, ErrInvalidTargetVersion) {
+		t.Errorf("expected %v but got %v", ErrInvalidTargetVersion, err)
+	}
+}
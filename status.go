@@ -0,0 +1,134 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ChecksumState is the result of comparing the stored checksum of a migration with the loaded
+// migration.
+type ChecksumState string
+
+const (
+	// ChecksumNone is the state of migrations that has not been applied.
+	ChecksumNone ChecksumState = ""
+	// ChecksumMatch is the state of applied migrations that has not been changed.
+	ChecksumMatch ChecksumState = "match"
+	// ChecksumMismatch is the state of applied migrations that has been changed since they
+	// were run, see Repair.
+	ChecksumMismatch ChecksumState = "mismatch"
+	// ChecksumMissing is the state of applied migrations that has no stored checksum, for
+	// example migrations applied before checksums were introduced.
+	ChecksumMissing ChecksumState = "missing"
+)
+
+// Status is the state of the database and of every loaded migration.
+type Status struct {
+	// Version is the current version of the database.
+	Version int
+	// Dirty is the version of a migration that failed midway, 0 if the database is not dirty.
+	Dirty int
+	// Unknown is set when Version does not match any loaded migration, for example when the
+	// database has been migrated to a version higher than the last loaded migration.
+	Unknown    bool
+	Migrations []MigrationStatus
+}
+
+// MigrationStatus is the state of a migration in the database.
+type MigrationStatus struct {
+	Migration Migration
+	Applied   bool
+	// AppliedAt is when the migration was last applied or baselined according to the
+	// history, it is the zero time if the migration is not applied or was applied before the
+	// history was introduced.
+	AppliedAt time.Time
+	Checksum  ChecksumState
+	// HasDown is set if the migration has a down statement or function.
+	HasDown bool
+}
+
+// Pending returns the migrations that has not been applied.
+func (s Status) Pending() []Migration {
+	pending := []Migration{}
+	for _, ms := range s.Migrations {
+		if !ms.Applied {
+			pending = append(pending, ms.Migration)
+		}
+	}
+	return pending
+}
+
+// String returns the status as a table, one migration per row.
+func (s Status) String() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "version %v", s.Version)
+	if s.Dirty != 0 {
+		fmt.Fprintf(&sb, " (dirty, migration of version %v failed midway)", s.Dirty)
+	}
+	if s.Unknown {
+		sb.WriteString(" (unknown, does not match any migration)")
+	}
+	sb.WriteString("\n\n")
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tTAG\tAPPLIED\tAPPLIED AT\tCHECKSUM\tDOWN\tCOMMENT")
+	for _, ms := range s.Migrations {
+		appliedAt := ""
+		if !ms.AppliedAt.IsZero() {
+			appliedAt = ms.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%v\t%s\t%v\t%s\t%s\t%v\t%s\n", ms.Migration.Version(), ms.Migration.Tag, ms.Applied, appliedAt, ms.Checksum, ms.HasDown, ms.Migration.Comment)
+	}
+	tw.Flush()
+	return sb.String()
+}
+
+// status returns the status of the database and all loaded migrations. Unlike Migrate it does
+// not fail if the database is dirty, at an unknown version or has changed migrations, these
+// are reported in the status instead.
+func (b base) status(ctx context.Context) (Status, error) {
+	v, err := b.version(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	dirty, err := b.dirty(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	stored, err := b.checksums(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	history, err := b.HistoryContext(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	appliedAt := map[int]time.Time{}
+	for _, e := range history {
+		if e.Success && e.Direction != directionDown.String() {
+			appliedAt[e.Version] = e.FinishedAt
+		}
+	}
+
+	_, found := b.migrations.position(v)
+	s := Status{Version: v, Dirty: dirty, Unknown: !found, Migrations: []MigrationStatus{}}
+	for _, mig := range b.migrations.Migrations {
+		ms := MigrationStatus{Migration: mig, Applied: mig.version <= v, HasDown: mig.hasDown()}
+		if ms.Applied {
+			ms.AppliedAt = appliedAt[mig.version]
+			checksum, found := stored[mig.version]
+			switch {
+			case !found:
+				ms.Checksum = ChecksumMissing
+			case checksum == mig.Checksum():
+				ms.Checksum = ChecksumMatch
+			default:
+				ms.Checksum = ChecksumMismatch
+			}
+		}
+		s.Migrations = append(s.Migrations, ms)
+	}
+	return s, nil
+}
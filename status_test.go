@@ -0,0 +1,76 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSQLiteStatus(t *testing.T) {
+	db := initSQLiteTest(t)
+	defer db.Close()
+	migrations := Migrations{Migrations: []Migration{
+		{Comment: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a", Tag: "2024.09"},
+		{Comment: "b", Up: "CREATE TABLE b (id INTEGER)"},
+		{Comment: "c", Up: "CREATE TABLE c (id INTEGER)", Down: "DROP TABLE c"},
+	}}
+	m, err := New(db, Sqlite, WithMigrations(migrations), WithTarget(2))
+	if err != nil {
+		t.Fatalf("error while creating migrator: %s", err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		t.Fatalf("error while running Migrate: %s", err)
+	}
+	if _, err := db.Exec("UPDATE _migrator_checksums_ SET checksum = 'changed' WHERE version = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Status()
+	if err != nil {
+		t.Fatalf("error while running Status: %s", err)
+	}
+	if s.Version != 2 || s.Dirty != 0 || s.Unknown {
+		t.Errorf("expected version 2, not dirty and not unknown but got %v, %v, %v", s.Version, s.Dirty, s.Unknown)
+	}
+	type Expected struct {
+		Applied  bool
+		Checksum ChecksumState
+		HasDown  bool
+	}
+	expected := []Expected{
+		{Applied: true, Checksum: ChecksumMatch, HasDown: true},
+		{Applied: true, Checksum: ChecksumMismatch, HasDown: false},
+		{Applied: false, Checksum: ChecksumNone, HasDown: true},
+	}
+	if len(s.Migrations) != len(expected) {
+		t.Fatalf("expected %v migrations but got %v", len(expected), len(s.Migrations))
+	}
+	for i, ms := range s.Migrations {
+		actual := Expected{Applied: ms.Applied, Checksum: ms.Checksum, HasDown: ms.HasDown}
+		if actual != expected[i] {
+			t.Errorf("%v: expected %v but got %v", i, expected[i], actual)
+		}
+		if ms.Applied == ms.AppliedAt.IsZero() {
+			t.Errorf("%v: expected applied at to be set only for applied migrations but was %v", i, ms.AppliedAt)
+		}
+	}
+	if pending := s.Pending(); len(pending) != 1 || pending[0].Version() != 3 {
+		t.Errorf("expected version 3 to be pending but got %v", pending)
+	}
+	if !strings.Contains(s.String(), "2024.09") {
+		t.Errorf("expected tag in status:\n%s", s)
+	}
+
+	// database version higher than the loaded migrations
+	if _, err := db.Exec("UPDATE _migrator_ SET version = 5"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = m.Status(); err != nil {
+		t.Fatalf("error while running Status: %s", err)
+	}
+	if !s.Unknown {
+		t.Errorf("expected version 5 to be unknown")
+	}
+	if len(s.Pending()) != 0 {
+		t.Errorf("expected no pending migrations but got %v", s.Pending())
+	}
+}
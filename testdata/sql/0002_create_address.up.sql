@@ -0,0 +1 @@
+CREATE TABLE address (id INTEGER PRIMARY KEY);